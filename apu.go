@@ -5,6 +5,14 @@ import "fmt"
 type apu struct {
 	// not marshalled in snapshot
 	buffer apuCircleBuf
+	wavOut *wavWriter
+	wavErr error
+
+	recorder    Recorder
+	recorderErr error
+
+	// repeated to fill an underflow
+	lastSample [soundBytesPerSample]byte
 
 	LeftSample  uint32
 	RightSample uint32
@@ -56,11 +64,12 @@ type apuCircleBuf struct {
 	buf        [apuCircleBufSize]byte
 }
 
+// writes all of bytes or none of it, so samples are never split
 func (c *apuCircleBuf) write(bytes []byte) (writeCount int) {
+	if uint(len(c.buf))-c.size() < uint(len(bytes)) {
+		return 0
+	}
 	for _, b := range bytes {
-		if c.full() {
-			return writeCount
-		}
 		c.buf[c.mask(c.writeIndex)] = b
 		c.writeIndex++
 		writeCount++
@@ -89,9 +98,11 @@ func (apu *apu) readSoundBuffer(toFill []byte) []byte {
 	}
 	if int(apu.buffer.size()) < len(toFill) {
 		fmt.Println("[apu] readSoundBuffer() underflow!")
-		// stretch sound to fill buffer to avoid click
-		for int(apu.buffer.size()) < len(toFill) {
-			apu.genSample()
+		// stretch sound to fill buffer to avoid click. This repeats the
+		// last sample rather than running the apu ahead, so the sound
+		// (and any recording of it) stays in step with emulated time.
+		for int(apu.buffer.size()) < len(toFill) && !apu.buffer.full() {
+			apu.buffer.write(apu.lastSample[:])
 		}
 	}
 	return apu.buffer.read(toFill)
@@ -140,12 +151,15 @@ func (apu *apu) genSample() {
 		right = correctedRight
 
 		iSampleL, iSampleR := int16(left*32767.0), int16(right*32767.0)
-		apu.buffer.write([]byte{
+		sample := []byte{
 			byte(iSampleL & 0xff),
 			byte(iSampleL >> 8),
 			byte(iSampleR & 0xff),
 			byte(iSampleR >> 8),
-		})
+		}
+		apu.buffer.write(sample)
+		copy(apu.lastSample[:], sample)
+		apu.recordSample(sample)
 
 		apu.LeftSample = 0
 		apu.RightSample = 0
@@ -153,6 +167,47 @@ func (apu *apu) genSample() {
 	}
 }
 
+// the recording gets every sample as it's made, so it's the same
+// however the frontend reads the buffer
+func (apu *apu) recordSample(sample []byte) {
+	if apu.wavOut != nil && apu.wavErr == nil {
+		apu.wavErr = apu.wavOut.write(sample)
+	}
+	if apu.recorder != nil && apu.recorderErr == nil {
+		apu.recorderErr = apu.recorder.WriteAudio(sample)
+	}
+}
+
+func (apu *apu) setRecorder(rec Recorder) error {
+	err := apu.recorderErr
+	apu.recorder, apu.recorderErr = rec, nil
+	return err
+}
+
+func (apu *apu) startRecording(filename string) error {
+	if apu.wavOut != nil {
+		return fmt.Errorf("already recording sound")
+	}
+	wavOut, err := createWAV(filename)
+	if err != nil {
+		return err
+	}
+	apu.wavOut, apu.wavErr = wavOut, nil
+	return nil
+}
+
+func (apu *apu) stopRecording() error {
+	if apu.wavOut == nil {
+		return fmt.Errorf("not recording sound")
+	}
+	err := apu.wavErr
+	if closeErr := apu.wavOut.close(); err == nil {
+		err = closeErr
+	}
+	apu.wavOut, apu.wavErr = nil, nil
+	return err
+}
+
 func (apu *apu) runCycle(cs *cpuState) {
 
 	apu.LengthTimeCounter++
@@ -173,7 +228,9 @@ func (apu *apu) runCycle(cs *cpuState) {
 		}
 	}
 
-	if apu.LengthTimeCounter&1 == 0 && !apu.buffer.full() {
+	// samples are made even when the buffer is full (they're dropped
+	// there) so the apu never stalls behind emulated time
+	if apu.LengthTimeCounter&1 == 0 {
 		apu.genSample()
 	}
 }
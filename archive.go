@@ -0,0 +1,268 @@
+package dmgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// biggest real carts are 8MB, this just keeps bad archives from eating all our RAM
+const maxCartFileSize = 32 * 1024 * 1024
+
+var cartExtensions = []string{".gb", ".gbc", ".gbs", ".sgb"}
+
+// enough of the start of a file for looksLikeCart
+const cartHeadSize = 0x150
+
+type archiveEntry struct {
+	name string
+	read func() ([]byte, error)
+	// the first cartHeadSize bytes (or fewer, if the file's shorter)
+	head func() ([]byte, error)
+}
+
+// ReadCartFile reads a rom or gbs file, unpacking it first if it's a
+// zip, gzip, or tar (or tar.gz) archive. For archives, entryName picks
+// the entry to use by full path or base name. Otherwise the first entry
+// (sorted by name) with a cart extension is used, falling back to the
+// first entry with a valid looking header. Returns the cart bytes and
+// the name of the entry used.
+func ReadCartFile(filename string, entryName string) ([]byte, string, error) {
+	fileBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	return ReadCartBytes(fileBytes, filename, entryName)
+}
+
+// ReadCartBytes is ReadCartFile for a file that's already in memory
+func ReadCartBytes(fileBytes []byte, filename string, entryName string) ([]byte, string, error) {
+	var entries []archiveEntry
+	var err error
+	switch {
+	case isZip(fileBytes):
+		entries, err = zipEntries(fileBytes)
+	case isGzip(fileBytes):
+		entries, err = gzipEntries(fileBytes, filename, entryName)
+	case isTar(fileBytes):
+		entries, err = tarEntries(bytes.NewReader(fileBytes), entryName)
+	default:
+		if entryName != "" {
+			return nil, "", fmt.Errorf("entry %q requested, but %q is not an archive", entryName, filename)
+		}
+		return fileBytes, filename, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return pickArchiveEntry(entries, entryName)
+}
+
+func pickArchiveEntry(entries []archiveEntry, entryName string) ([]byte, string, error) {
+	if len(entries) == 0 {
+		return nil, "", fmt.Errorf("archive is empty")
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	if entryName != "" {
+		for _, e := range entries {
+			if entryMatches(e.name, entryName) {
+				cart, err := e.read()
+				return cart, e.name, err
+			}
+		}
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.name)
+		}
+		return nil, "", fmt.Errorf("entry %q not found in archive, entries are: %s", entryName, strings.Join(names, ", "))
+	}
+
+	for _, e := range entries {
+		if hasCartExtension(e.name) {
+			cart, err := e.read()
+			return cart, e.name, err
+		}
+	}
+	for _, e := range entries {
+		if head, err := e.head(); err == nil && looksLikeCart(head) {
+			cart, err := e.read()
+			return cart, e.name, err
+		}
+	}
+	return nil, "", fmt.Errorf("no rom found in archive")
+}
+
+func entryMatches(name, entryName string) bool {
+	return name == entryName || path.Base(name) == entryName
+}
+
+func hasCartExtension(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, cartExt := range cartExtensions {
+		if ext == cartExt {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeCart(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("GBS")) {
+		return true
+	}
+	return len(data) >= 0x150 && bytes.Equal(data[0x104:0x134], nintendoLogo[:])
+}
+
+func isZip(data []byte) bool  { return bytes.HasPrefix(data, []byte("PK\x03\x04")) }
+func isGzip(data []byte) bool { return bytes.HasPrefix(data, []byte{0x1f, 0x8b}) }
+func isTar(data []byte) bool {
+	return len(data) >= 262 && bytes.Equal(data[257:262], []byte("ustar"))
+}
+
+func bytesReader(data []byte) func() ([]byte, error) {
+	return func() ([]byte, error) { return data, nil }
+}
+
+func readHead(r io.Reader) ([]byte, error) {
+	head := make([]byte, cartHeadSize)
+	n, err := io.ReadFull(r, head)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+func readAllLimited(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxCartFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCartFileSize {
+		return nil, fmt.Errorf("file in archive is too large to be a rom")
+	}
+	return data, nil
+}
+
+// a gzip is either a tar.gz, streamed into the tar reader so the size
+// limit is per entry, or a single gzipped file
+func gzipEntries(data []byte, filename string, entryName string) ([]archiveEntry, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+	reader := bufio.NewReader(gzReader)
+	if header, _ := reader.Peek(262); isTar(header) {
+		return tarEntries(reader, entryName)
+	}
+	unpacked, err := readAllLimited(reader)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(path.Base(filename), ".gz")
+	return []archiveEntry{{name: name, read: bytesReader(unpacked), head: bytesReader(unpacked)}}, nil
+}
+
+func zipEntries(data []byte) ([]archiveEntry, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	entries := []archiveEntry{}
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		f := f
+		readWith := func(readFn func(io.Reader) ([]byte, error)) func() ([]byte, error) {
+			return func() ([]byte, error) {
+				reader, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer reader.Close()
+				return readFn(reader)
+			}
+		}
+		entries = append(entries, archiveEntry{
+			name: f.Name,
+			read: readWith(readAllLimited),
+			head: readWith(readHead),
+		})
+	}
+	return entries, nil
+}
+
+// tar can only be read in order, so this picks as it goes: of each
+// kind of entry pickArchiveEntry looks for, only the first by name has
+// its bytes kept. The rest keep just their name and head.
+func tarEntries(r io.Reader, entryName string) ([]archiveEntry, error) {
+	tarReader := tar.NewReader(r)
+	entries := []archiveEntry{}
+	kept := map[string]int{} // kind -> index in entries
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		head, err := readHead(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		e := archiveEntry{name: hdr.Name, read: notKept, head: bytesReader(head)}
+		if hdr.Size > maxCartFileSize {
+			// too big to be a rom, but that's only an error if it's picked
+			e.read = func() ([]byte, error) {
+				return nil, fmt.Errorf("file in archive is too large to be a rom")
+			}
+		} else if kind := tarEntryKind(hdr.Name, head, entryName); kind != "" {
+			if i, ok := kept[kind]; !ok || hdr.Name < entries[i].name {
+				rest, err := readAllLimited(tarReader)
+				if err != nil {
+					return nil, err
+				}
+				e.read = bytesReader(append(head, rest...))
+				if ok {
+					entries[i].read = notKept
+				}
+				kept[kind] = len(entries)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// which of pickArchiveEntry's searches could pick this entry, if any
+func tarEntryKind(name string, head []byte, entryName string) string {
+	switch {
+	case entryName != "":
+		if entryMatches(name, entryName) {
+			return "requested"
+		}
+	case hasCartExtension(name):
+		return "extension"
+	case looksLikeCart(head):
+		return "header"
+	}
+	return ""
+}
+
+func notKept() ([]byte, error) {
+	return nil, fmt.Errorf("archive entry was skipped while reading")
+}
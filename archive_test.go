@@ -0,0 +1,162 @@
+package dmgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+type testArchiveFile struct {
+	name string
+	data []byte
+}
+
+func makeTar(t *testing.T, w io.Writer, files ...testArchiveFile) {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeGzip(t *testing.T, write func(w io.Writer)) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	write(gw)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadCartBytesArchives(t *testing.T) {
+	rom := loopROM()
+	junk := make([]byte, maxCartFileSize+1024)
+
+	zipBuf := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBuf)
+	for _, f := range []testArchiveFile{{"readme.txt", []byte("hi")}, {"dir/game.gb", rom}} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	zw.Close()
+
+	tarBuf := &bytes.Buffer{}
+	makeTar(t, tarBuf, testArchiveFile{"a.txt", []byte("hi")}, testArchiveFile{"game.gbc", rom})
+
+	for _, tc := range []struct {
+		name      string
+		file      []byte
+		filename  string
+		entry     string
+		wantEntry string
+		wantErr   bool
+	}{
+		{name: "plain rom", file: rom, filename: "game.gb", wantEntry: "game.gb"},
+		{name: "zip", file: zipBuf.Bytes(), filename: "game.zip", wantEntry: "dir/game.gb"},
+		{name: "zip by base name", file: zipBuf.Bytes(), filename: "game.zip", entry: "game.gb", wantEntry: "dir/game.gb"},
+		{name: "zip missing entry", file: zipBuf.Bytes(), filename: "game.zip", entry: "nope.gb", wantErr: true},
+		{name: "tar", file: tarBuf.Bytes(), filename: "game.tar", wantEntry: "game.gbc"},
+		{name: "gzip", file: makeGzip(t, func(w io.Writer) { w.Write(rom) }), filename: "game.gb.gz", wantEntry: "game.gb"},
+		{name: "tar.gz", file: makeGzip(t, func(w io.Writer) { w.Write(tarBuf.Bytes()) }), filename: "game.tar.gz", wantEntry: "game.gbc"},
+		{
+			// the whole tar is over the size limit, but each rom isn't
+			name: "big tar.gz",
+			file: makeGzip(t, func(w io.Writer) {
+				makeTar(t, w, testArchiveFile{"a_video.bin", junk}, testArchiveFile{"b_padding.bin", junk[:maxCartFileSize-1]}, testArchiveFile{"game.gb", rom})
+			}),
+			filename:  "game.tar.gz",
+			wantEntry: "game.gb",
+		},
+		{
+			name: "picking a too big tar.gz entry",
+			file: makeGzip(t, func(w io.Writer) {
+				makeTar(t, w, testArchiveFile{"a_video.bin", junk}, testArchiveFile{"game.gb", rom})
+			}),
+			filename: "game.tar.gz",
+			entry:    "a_video.bin",
+			wantErr:  true,
+		},
+		{
+			name: "tar picks the first rom by name",
+			file: func() []byte {
+				buf := &bytes.Buffer{}
+				makeTar(t, buf, testArchiveFile{"b.gb", junk[:0x8000]}, testArchiveFile{"a.gb", rom}, testArchiveFile{"c.gb", junk[:0x8000]})
+				return buf.Bytes()
+			}(),
+			filename:  "games.tar",
+			wantEntry: "a.gb",
+		},
+		{
+			name: "tar falls back to a valid header",
+			file: func() []byte {
+				buf := &bytes.Buffer{}
+				makeTar(t, buf, testArchiveFile{"b.bin", junk[:0x8000]}, testArchiveFile{"c.bin", rom}, testArchiveFile{"a.txt", []byte("hi")})
+				return buf.Bytes()
+			}(),
+			filename:  "game.tar",
+			wantEntry: "c.bin",
+		},
+		{name: "too big gzip", file: makeGzip(t, func(w io.Writer) { w.Write(junk) }), filename: "game.gb.gz", wantErr: true},
+	} {
+		cart, entry, err := ReadCartBytes(tc.file, tc.filename, tc.entry)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if entry != tc.wantEntry || !bytes.Equal(cart, rom) {
+			t.Errorf("%s: got entry %q (rom matches: %v), want %q", tc.name, entry, bytes.Equal(cart, rom), tc.wantEntry)
+		}
+	}
+}
+
+func TestTarEntriesKeepOnlyPickable(t *testing.T) {
+	rom := loopROM()
+	other := make([]byte, 0x8000)
+	buf := &bytes.Buffer{}
+	makeTar(t, buf,
+		testArchiveFile{"z.gb", other}, testArchiveFile{"m.gb", rom}, testArchiveFile{"y.gb", other},
+		testArchiveFile{"readme.txt", []byte("hi")}, testArchiveFile{"x.bin", rom}, testArchiveFile{"w.bin", rom})
+	for _, tc := range []struct {
+		entryName string
+		wantKept  []string
+	}{
+		{"", []string{"m.gb", "w.bin"}},
+		{"y.gb", []string{"y.gb"}},
+	} {
+		entries, err := tarEntries(bytes.NewReader(buf.Bytes()), tc.entryName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := []string{}
+		for _, e := range entries {
+			if _, err := e.read(); err == nil {
+				kept = append(kept, e.name)
+			}
+		}
+		if strings.Join(kept, ",") != strings.Join(tc.wantKept, ",") {
+			t.Errorf("entry %q: kept %v, want %v", tc.entryName, kept, tc.wantKept)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package dmgo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// aviRecorder writes an uncompressed AVI: 24-bit RGB frames at the
+// DMG's real frame rate, with 16-bit 44.1kHz stereo PCM sound
+// interleaved after each frame.
+type aviRecorder struct {
+	f *os.File
+	w *bufio.Writer
+
+	// bytes written so far, i.e. where the next chunk goes
+	pos uint32
+
+	numFrames  uint32
+	numSamples uint32
+
+	frameBuf []byte
+	audioBuf []byte
+
+	// idx1 entries, written on close
+	index []byte
+}
+
+// 4194304 clocks per second / 70224 clocks per frame = ~59.73fps
+const (
+	aviFrameRateNum   = 4194304
+	aviFrameRateDen   = 70224
+	aviFrameSize      = 160 * 144 * 3
+	aviMaxSize        = 1 << 30 // AVI 1.0 files much past 1GB trip up most players
+	aviHeaderListSize = 4 + (8 + 56) + 2*(12+(8+56)) + (8 + 40) + (8 + 18)
+)
+
+// offsets into the file of the fields that close fills in
+const (
+	aviRIFFSizeOffset       = 4
+	aviTotalFramesOffset    = 12 + 12 + 8 + 16
+	aviVideoLengthOffset    = 12 + 12 + (8 + 56) + 12 + 8 + 32
+	aviAudioLengthOffset    = aviVideoLengthOffset + 56 + (8 + 40) + 12 + 8
+	aviMoviListSizeOffset   = 12 + 8 + aviHeaderListSize + 4
+	aviMoviFourCCOffset     = aviMoviListSizeOffset + 4
+	aviIndexKeyframe        = 0x10
+	aviFlagHasIndex         = 0x10
+	aviFlagIsInterleaved    = 0x100
+	aviVideoSuggestedBuffer = aviFrameSize
+)
+
+func newAVIRecorder(filename string) (*aviRecorder, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &aviRecorder{
+		f:        f,
+		w:        bufio.NewWriter(f),
+		frameBuf: make([]byte, aviFrameSize),
+	}
+	if err := r.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+type leBuf []byte
+
+func (b *leBuf) str(s string) { *b = append(*b, s...) }
+func (b *leBuf) u16(v uint16) { *b = append(*b, byte(v), byte(v>>8)) }
+func (b *leBuf) u32(v uint32) { *b = append(*b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24)) }
+
+func (r *aviRecorder) writeHeader() error {
+	var b leBuf
+	b.str("RIFF")
+	b.u32(0) // filled in on close
+	b.str("AVI ")
+
+	b.str("LIST")
+	b.u32(aviHeaderListSize)
+	b.str("hdrl")
+
+	b.str("avih")
+	b.u32(56)
+	b.u32(1000000 * aviFrameRateDen / aviFrameRateNum) // microseconds per frame
+	b.u32(0)                                           // max bytes per sec
+	b.u32(0)                                           // padding granularity
+	b.u32(aviFlagHasIndex | aviFlagIsInterleaved)
+	b.u32(0) // total frames, filled in on close
+	b.u32(0) // initial frames
+	b.u32(2) // streams
+	b.u32(aviVideoSuggestedBuffer)
+	b.u32(160)
+	b.u32(144)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+
+	b.str("LIST")
+	b.u32(4 + (8 + 56) + (8 + 40))
+	b.str("strl")
+	b.str("strh")
+	b.u32(56)
+	b.str("vids")
+	b.str("DIB ")
+	b.u32(0) // flags
+	b.u16(0) // priority
+	b.u16(0) // language
+	b.u32(0) // initial frames
+	b.u32(aviFrameRateDen)
+	b.u32(aviFrameRateNum)
+	b.u32(0) // start
+	b.u32(0) // length, filled in on close
+	b.u32(aviVideoSuggestedBuffer)
+	b.u32(0xffffffff) // default quality
+	b.u32(0)          // sample size, 0 is varies
+	b.u16(0)
+	b.u16(0)
+	b.u16(160)
+	b.u16(144)
+	b.str("strf")
+	b.u32(40) // BITMAPINFOHEADER
+	b.u32(40)
+	b.u32(160)
+	b.u32(144) // positive is bottom to top
+	b.u16(1)   // planes
+	b.u16(24)  // bits per pixel
+	b.u32(0)   // BI_RGB
+	b.u32(aviFrameSize)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+
+	b.str("LIST")
+	b.u32(4 + (8 + 56) + (8 + 18))
+	b.str("strl")
+	b.str("strh")
+	b.u32(56)
+	b.str("auds")
+	b.u32(0)
+	b.u32(0) // flags
+	b.u16(0) // priority
+	b.u16(0) // language
+	b.u32(0) // initial frames
+	b.u32(soundBytesPerSample)
+	b.u32(samplesPerSecond * soundBytesPerSample)
+	b.u32(0) // start
+	b.u32(0) // length in samples, filled in on close
+	b.u32(samplesPerSecond * soundBytesPerSample)
+	b.u32(0xffffffff) // default quality
+	b.u32(soundBytesPerSample)
+	b.u16(0)
+	b.u16(0)
+	b.u16(0)
+	b.u16(0)
+	b.str("strf")
+	b.u32(18) // WAVEFORMATEX
+	fmtBytes := make([]byte, 16)
+	putWaveFormat(fmtBytes)
+	b = append(b, fmtBytes...)
+	b.u16(0) // no extra format bytes
+
+	b.str("LIST")
+	b.u32(0) // filled in on close
+	b.str("movi")
+
+	if len(b) != aviMoviFourCCOffset+4 {
+		return fmt.Errorf("avi header is %d bytes, expected %d", len(b), aviMoviFourCCOffset+4)
+	}
+	return r.write(b)
+}
+
+func (r *aviRecorder) write(b []byte) error {
+	n, err := r.w.Write(b)
+	r.pos += uint32(n)
+	return err
+}
+
+func (r *aviRecorder) writeChunk(fourCC string, data []byte) error {
+	if uint64(r.pos)+uint64(len(r.index))+8+uint64(len(data))+16 > aviMaxSize {
+		return fmt.Errorf("avi file full (1GB)")
+	}
+	var idx leBuf = r.index
+	idx.str(fourCC)
+	idx.u32(aviIndexKeyframe)
+	idx.u32(r.pos - aviMoviFourCCOffset)
+	idx.u32(uint32(len(data)))
+	r.index = idx
+
+	var hdr leBuf
+	hdr.str(fourCC)
+	hdr.u32(uint32(len(data)))
+	if err := r.write(hdr); err != nil {
+		return err
+	}
+	return r.write(data)
+}
+
+func (r *aviRecorder) WriteFrame(framebuffer []byte) error {
+	// RGBA top to bottom to BGR bottom to top
+	for y := 0; y < 144; y++ {
+		src := framebuffer[y*160*4:]
+		dst := r.frameBuf[(143-y)*160*3:]
+		for x := 0; x < 160; x++ {
+			dst[x*3+0] = src[x*4+2]
+			dst[x*3+1] = src[x*4+1]
+			dst[x*3+2] = src[x*4+0]
+		}
+	}
+	if err := r.writeChunk("00db", r.frameBuf); err != nil {
+		return err
+	}
+	r.numFrames++
+	return r.flushAudio()
+}
+
+func (r *aviRecorder) WriteAudio(samples []byte) error {
+	// held until the next frame so there's one chunk per frame
+	r.audioBuf = append(r.audioBuf, samples...)
+	return nil
+}
+
+func (r *aviRecorder) flushAudio() error {
+	n := len(r.audioBuf) - len(r.audioBuf)%soundBytesPerSample
+	if n == 0 {
+		return nil
+	}
+	if err := r.writeChunk("01wb", r.audioBuf[:n]); err != nil {
+		return err
+	}
+	r.numSamples += uint32(n / soundBytesPerSample)
+	r.audioBuf = append(r.audioBuf[:0], r.audioBuf[n:]...)
+	return nil
+}
+
+func (r *aviRecorder) Close() error {
+	err := r.flushAudio()
+	moviEnd := r.pos
+	if err == nil {
+		var hdr leBuf
+		hdr.str("idx1")
+		hdr.u32(uint32(len(r.index)))
+		err = r.write(append(hdr, r.index...))
+	}
+	if err == nil {
+		err = r.w.Flush()
+	}
+	for _, patch := range []struct {
+		offset int64
+		val    uint32
+	}{
+		{aviRIFFSizeOffset, r.pos - 8},
+		{aviTotalFramesOffset, r.numFrames},
+		{aviVideoLengthOffset, r.numFrames},
+		{aviAudioLengthOffset, r.numSamples},
+		{aviMoviListSizeOffset, moviEnd - aviMoviFourCCOffset},
+	} {
+		if err == nil {
+			err = patchUint32(r.f, patch.offset, patch.val)
+		}
+	}
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -30,12 +30,20 @@ type CartInfo struct {
 	MaskRomVersion byte
 	// HeaderChecksum is a checksum of the header which must be correct for the game to run
 	HeaderChecksum byte
+	// GlobalChecksum is a checksum of the whole ROM. Not checked by hardware.
+	GlobalChecksum uint16
+	// Logo is the bitmap checked against the real logo by the boot rom
+	Logo [48]byte
+
+	fileSize               int
+	computedHeaderChecksum byte
+	computedGlobalChecksum uint16
 }
 
 // GetRAMSize decodes the ram size code into an actual size
-func (ci *CartInfo) GetRAMSize() uint {
+func (ci *CartInfo) GetRAMSize() (uint, error) {
 	if ci.CartridgeType == 5 || ci.CartridgeType == 6 {
-		return 512
+		return 512, nil
 	}
 	codeSizeMap := map[byte]uint{
 		0x00: 0,
@@ -46,13 +54,13 @@ func (ci *CartInfo) GetRAMSize() uint {
 		0x05: 64 * 1024,
 	}
 	if size, ok := codeSizeMap[ci.RAMSizeCode]; ok {
-		return size
+		return size, nil
 	}
-	panic(fmt.Sprintf("unknown RAM size code 0x%02x", ci.RAMSizeCode))
+	return 0, fmt.Errorf("unknown RAM size code 0x%02x", ci.RAMSizeCode)
 }
 
 // GetROMSize decodes the ROM size code into an actual size
-func (ci *CartInfo) GetROMSize() uint {
+func (ci *CartInfo) GetROMSize() (uint, error) {
 	codeSizeMap := map[byte]uint{
 		0x00: 32 * 1024,   // no banking
 		0x01: 64 * 1024,   // 4 banks
@@ -68,16 +76,20 @@ func (ci *CartInfo) GetROMSize() uint {
 		0x54: 1536 * 1024, // 96 banks
 	}
 	if size, ok := codeSizeMap[ci.ROMSizeCode]; ok {
-		return size
+		return size, nil
 	}
-	panic(fmt.Sprintf("unknown ROM size code 0x%02x", ci.RAMSizeCode))
+	return 0, fmt.Errorf("unknown ROM size code 0x%02x", ci.ROMSizeCode)
 }
 
 func (ci *CartInfo) cgbOnly() bool     { return ci.CGBFlag == 0xc0 }
 func (ci *CartInfo) cgbOptional() bool { return ci.CGBFlag == 0x80 }
 
 // ParseCartInfo parses a dmg cart header
-func ParseCartInfo(cartBytes []byte) *CartInfo {
+func ParseCartInfo(cartBytes []byte) (*CartInfo, error) {
+	if len(cartBytes) < 0x150 {
+		return nil, fmt.Errorf("cart is too small to contain a header")
+	}
+
 	cart := CartInfo{}
 
 	cart.CGBFlag = cartBytes[0x143]
@@ -99,8 +111,332 @@ func ParseCartInfo(cartBytes []byte) *CartInfo {
 	}
 	cart.MaskRomVersion = cartBytes[0x14c]
 	cart.HeaderChecksum = cartBytes[0x14d]
+	cart.GlobalChecksum = uint16(cartBytes[0x14e])<<8 | uint16(cartBytes[0x14f])
+	copy(cart.Logo[:], cartBytes[0x104:0x134])
+
+	cart.fileSize = len(cartBytes)
+	for _, b := range cartBytes[0x134:0x14d] {
+		cart.computedHeaderChecksum -= b + 1
+	}
+	for i, b := range cartBytes {
+		if i != 0x14e && i != 0x14f {
+			cart.computedGlobalChecksum += uint16(b)
+		}
+	}
+
+	return &cart, nil
+}
+
+var nintendoLogo = [48]byte{
+	0xce, 0xed, 0x66, 0x66, 0xcc, 0x0d, 0x00, 0x0b, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0c, 0x00, 0x0d,
+	0x00, 0x08, 0x11, 0x1f, 0x88, 0x89, 0x00, 0x0e, 0xdc, 0xcc, 0x6e, 0xe6, 0xdd, 0xdd, 0xd9, 0x99,
+	0xbb, 0xbb, 0x67, 0x63, 0x6e, 0x0e, 0xec, 0xcc, 0xdd, 0xdc, 0x99, 0x9f, 0xbb, 0xb9, 0x33, 0x3e,
+}
+
+// ComputedHeaderChecksum is the header checksum the boot rom expects
+func (ci *CartInfo) ComputedHeaderChecksum() byte { return ci.computedHeaderChecksum }
+
+// ComputedGlobalChecksum is the actual sum of the ROM's bytes
+func (ci *CartInfo) ComputedGlobalChecksum() uint16 { return ci.computedGlobalChecksum }
+
+// Validate checks the header for anything that would keep the cart
+// from booting on real hardware or from running in dmgo. Returns
+// nil if no problems were found.
+func (ci *CartInfo) Validate() []error {
+	var errs []error
+	if ci.Logo != nintendoLogo {
+		errs = append(errs, fmt.Errorf("logo mismatch, real hardware will lock up at boot"))
+	}
+	if ci.HeaderChecksum != ci.computedHeaderChecksum {
+		errs = append(errs, fmt.Errorf("header checksum mismatch: header says 0x%02x, computed 0x%02x",
+			ci.HeaderChecksum, ci.computedHeaderChecksum))
+	}
+	if ci.GlobalChecksum != ci.computedGlobalChecksum {
+		errs = append(errs, fmt.Errorf("global checksum mismatch: header says 0x%04x, computed 0x%04x",
+			ci.GlobalChecksum, ci.computedGlobalChecksum))
+	}
+	if romSize, err := ci.GetROMSize(); err != nil {
+		errs = append(errs, err)
+	} else if int(romSize) != ci.fileSize {
+		errs = append(errs, fmt.Errorf("rom size mismatch: header says %d bytes, file is %d bytes",
+			romSize, ci.fileSize))
+	}
+	if _, err := ci.GetRAMSize(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, ok := cartTypeNames[ci.CartridgeType]; !ok {
+		errs = append(errs, fmt.Errorf("unknown cart type 0x%02x", ci.CartridgeType))
+	} else if _, err := makeMBC(ci); err != nil {
+		errs = append(errs, fmt.Errorf("unsupported cart type %s: %v", ci.CartridgeTypeName(), err))
+	}
+	return errs
+}
+
+var cartTypeNames = map[byte]string{
+	0x00: "ROM ONLY",
+	0x01: "MBC1",
+	0x02: "MBC1+RAM",
+	0x03: "MBC1+RAM+BATTERY",
+	0x05: "MBC2",
+	0x06: "MBC2+BATTERY",
+	0x08: "ROM+RAM",
+	0x09: "ROM+RAM+BATTERY",
+	0x0b: "MMM01",
+	0x0c: "MMM01+RAM",
+	0x0d: "MMM01+RAM+BATTERY",
+	0x0f: "MBC3+TIMER+BATTERY",
+	0x10: "MBC3+TIMER+RAM+BATTERY",
+	0x11: "MBC3",
+	0x12: "MBC3+RAM",
+	0x13: "MBC3+RAM+BATTERY",
+	0x19: "MBC5",
+	0x1a: "MBC5+RAM",
+	0x1b: "MBC5+RAM+BATTERY",
+	0x1c: "MBC5+RUMBLE",
+	0x1d: "MBC5+RUMBLE+RAM",
+	0x1e: "MBC5+RUMBLE+RAM+BATTERY",
+	0x20: "MBC6",
+	0x22: "MBC7+SENSOR+RUMBLE+RAM+BATTERY",
+	0xfc: "POCKET CAMERA",
+	0xfd: "BANDAI TAMA5",
+	0xfe: "HuC3",
+	0xff: "HuC1+RAM+BATTERY",
+}
+
+// CartridgeTypeName gives a readable name for the cart type
+func (ci *CartInfo) CartridgeTypeName() string {
+	if name, ok := cartTypeNames[ci.CartridgeType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%02x)", ci.CartridgeType)
+}
+
+// LicenseeName looks up the publisher from the old
+// or new licensee code, whichever the cart uses
+func (ci *CartInfo) LicenseeName() string {
+	if ci.OldLicenseeCode == 0x33 {
+		if name, ok := newLicenseeNames[ci.NewLicenseeCode]; ok {
+			return name
+		}
+		return fmt.Sprintf("unknown (new code %q)", ci.NewLicenseeCode)
+	}
+	if name, ok := oldLicenseeNames[ci.OldLicenseeCode]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (old code 0x%02x)", ci.OldLicenseeCode)
+}
+
+var newLicenseeNames = map[string]string{
+	"00": "None",
+	"01": "Nintendo R&D1",
+	"08": "Capcom",
+	"13": "Electronic Arts",
+	"18": "Hudson Soft",
+	"19": "b-ai",
+	"20": "kss",
+	"22": "pow",
+	"24": "PCM Complete",
+	"25": "san-x",
+	"28": "Kemco Japan",
+	"29": "seta",
+	"30": "Viacom",
+	"31": "Nintendo",
+	"32": "Bandai",
+	"33": "Ocean/Acclaim",
+	"34": "Konami",
+	"35": "Hector",
+	"37": "Taito",
+	"38": "Hudson",
+	"39": "Banpresto",
+	"41": "Ubi Soft",
+	"42": "Atlus",
+	"44": "Malibu",
+	"46": "angel",
+	"47": "Bullet-Proof",
+	"49": "irem",
+	"50": "Absolute",
+	"51": "Acclaim",
+	"52": "Activision",
+	"53": "American sammy",
+	"54": "Konami",
+	"55": "Hi tech entertainment",
+	"56": "LJN",
+	"57": "Matchbox",
+	"58": "Mattel",
+	"59": "Milton Bradley",
+	"60": "Titus",
+	"61": "Virgin",
+	"64": "LucasArts",
+	"67": "Ocean",
+	"69": "Electronic Arts",
+	"70": "Infogrames",
+	"71": "Interplay",
+	"72": "Broderbund",
+	"73": "sculptured",
+	"75": "sci",
+	"78": "THQ",
+	"79": "Accolade",
+	"80": "misawa",
+	"83": "lozc",
+	"86": "Tokuma Shoten Intermedia",
+	"87": "Tsukuda Original",
+	"91": "Chunsoft",
+	"92": "Video system",
+	"93": "Ocean/Acclaim",
+	"95": "Varie",
+	"96": "Yonezawa/s'pal",
+	"97": "Kaneko",
+	"99": "Pack in soft",
+	"A4": "Konami (Yu-Gi-Oh!)",
+}
 
-	return &cart
+var oldLicenseeNames = map[byte]string{
+	0x00: "None",
+	0x01: "Nintendo",
+	0x08: "Capcom",
+	0x09: "Hot-B",
+	0x0a: "Jaleco",
+	0x0b: "Coconuts Japan",
+	0x0c: "Elite Systems",
+	0x13: "Electronic Arts",
+	0x18: "Hudsonsoft",
+	0x19: "ITC Entertainment",
+	0x1a: "Yanoman",
+	0x1d: "Japan Clary",
+	0x1f: "Virgin Interactive",
+	0x24: "PCM Complete",
+	0x25: "San-X",
+	0x28: "Kotobuki Systems",
+	0x29: "Seta",
+	0x30: "Infogrames",
+	0x31: "Nintendo",
+	0x32: "Bandai",
+	0x34: "Konami",
+	0x35: "HectorSoft",
+	0x38: "Capcom",
+	0x39: "Banpresto",
+	0x3c: "Entertainment i",
+	0x3e: "Gremlin",
+	0x41: "Ubisoft",
+	0x42: "Atlus",
+	0x44: "Malibu",
+	0x46: "Angel",
+	0x47: "Spectrum Holoby",
+	0x49: "Irem",
+	0x4a: "Virgin Interactive",
+	0x4d: "Malibu",
+	0x4f: "U.S. Gold",
+	0x50: "Absolute",
+	0x51: "Acclaim",
+	0x52: "Activision",
+	0x53: "American Sammy",
+	0x54: "GameTek",
+	0x55: "Park Place",
+	0x56: "LJN",
+	0x57: "Matchbox",
+	0x59: "Milton Bradley",
+	0x5a: "Mindscape",
+	0x5b: "Romstar",
+	0x5c: "Naxat Soft",
+	0x5d: "Tradewest",
+	0x60: "Titus",
+	0x61: "Virgin Interactive",
+	0x67: "Ocean Interactive",
+	0x69: "Electronic Arts",
+	0x6e: "Elite Systems",
+	0x6f: "Electro Brain",
+	0x70: "Infogrames",
+	0x71: "Interplay",
+	0x72: "Broderbund",
+	0x73: "Sculptered Soft",
+	0x75: "The Sales Curve",
+	0x78: "t.hq",
+	0x79: "Accolade",
+	0x7a: "Triffix Entertainment",
+	0x7c: "Microprose",
+	0x7f: "Kemco",
+	0x80: "Misawa Entertainment",
+	0x83: "Lozc",
+	0x86: "Tokuma Shoten Intermedia",
+	0x8b: "Bullet-Proof Software",
+	0x8c: "Vic Tokai",
+	0x8e: "Ape",
+	0x8f: "I'Max",
+	0x91: "Chunsoft",
+	0x92: "Video System",
+	0x93: "Tsubaraya Productions",
+	0x95: "Varie",
+	0x96: "Yonezawa/S'Pal",
+	0x97: "Kaneko",
+	0x99: "Arc",
+	0x9a: "Nihon Bussan",
+	0x9b: "Tecmo",
+	0x9c: "Imagineer",
+	0x9d: "Banpresto",
+	0x9f: "Nova",
+	0xa1: "Hori Electric",
+	0xa2: "Bandai",
+	0xa4: "Konami",
+	0xa6: "Kawada",
+	0xa7: "Takara",
+	0xa9: "Technos Japan",
+	0xaa: "Broderbund",
+	0xac: "Toei Animation",
+	0xad: "Toho",
+	0xaf: "Namco",
+	0xb0: "Acclaim",
+	0xb1: "ASCII or Nexsoft",
+	0xb2: "Bandai",
+	0xb4: "Square Enix",
+	0xb6: "HAL Laboratory",
+	0xb7: "SNK",
+	0xb9: "Pony Canyon",
+	0xba: "Culture Brain",
+	0xbb: "Sunsoft",
+	0xbd: "Sony Imagesoft",
+	0xbf: "Sammy",
+	0xc0: "Taito",
+	0xc2: "Kemco",
+	0xc3: "Squaresoft",
+	0xc4: "Tokuma Shoten Intermedia",
+	0xc5: "Data East",
+	0xc6: "Tonkinhouse",
+	0xc8: "Koei",
+	0xc9: "UFL",
+	0xca: "Ultra",
+	0xcb: "Vap",
+	0xcc: "Use Corporation",
+	0xcd: "Meldac",
+	0xce: "Pony Canyon",
+	0xcf: "Angel",
+	0xd0: "Taito",
+	0xd1: "Sofel",
+	0xd2: "Quest",
+	0xd3: "Sigma Enterprises",
+	0xd4: "ASK Kodansha",
+	0xd6: "Naxat Soft",
+	0xd7: "Copya System",
+	0xd9: "Banpresto",
+	0xda: "Tomy",
+	0xdb: "LJN",
+	0xdd: "NCS",
+	0xde: "Human",
+	0xdf: "Altron",
+	0xe0: "Jaleco",
+	0xe1: "Towa Chiki",
+	0xe2: "Yutaka",
+	0xe3: "Varie",
+	0xe5: "Epoch",
+	0xe7: "Athena",
+	0xe8: "Asmik ACE Entertainment",
+	0xe9: "Natsume",
+	0xea: "King Records",
+	0xeb: "Atlus",
+	0xec: "Epic/Sony Records",
+	0xee: "IGS",
+	0xf0: "A Wave",
+	0xf3: "Extreme Entertainment",
+	0xff: "LJN",
 }
 
 func stripZeroes(s string) string {
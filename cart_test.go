@@ -0,0 +1,99 @@
+package dmgo
+
+import (
+	"strings"
+	"testing"
+)
+
+// testCart is testROM after edit, with both checksums made right again
+func testCart(edit func(rom []byte)) []byte {
+	rom := testROM(0x18, 0xfe)
+	rom[0x14b] = 0x01 // Nintendo
+	edit(rom)
+	fixHeaderChecksum(rom)
+	setGlobalChecksum(rom, 0)
+	return rom
+}
+
+// sets the global checksum to the real one plus delta
+func setGlobalChecksum(rom []byte, delta uint16) {
+	sum := delta
+	for i, b := range rom {
+		if i != 0x14e && i != 0x14f {
+			sum += uint16(b)
+		}
+	}
+	rom[0x14e], rom[0x14f] = byte(sum>>8), byte(sum)
+}
+
+func TestCartInfoValidate(t *testing.T) {
+	noEdit := func(rom []byte) {}
+	for _, tc := range []struct {
+		name string
+		edit func(rom []byte)
+		// for breaking the checksums testCart fixed
+		after    func(rom []byte)
+		wantErrs []string
+	}{
+		{"good", noEdit, noEdit, nil},
+		{"bad header checksum", noEdit, func(rom []byte) {
+			rom[0x14d]++
+			setGlobalChecksum(rom, 0)
+		}, []string{"header checksum mismatch"}},
+		{"bad global checksum", noEdit, func(rom []byte) { setGlobalChecksum(rom, 1) }, []string{"global checksum mismatch"}},
+		{"bad logo", func(rom []byte) { rom[0x104] = 0 }, noEdit, []string{"logo mismatch"}},
+		{"rom size mismatch", func(rom []byte) { rom[0x148] = 0x01 }, noEdit, []string{"rom size mismatch"}},
+		{"unknown rom size", func(rom []byte) { rom[0x148] = 0x42 }, noEdit, []string{"unknown ROM size code 0x42"}},
+		{"unknown ram size", func(rom []byte) { rom[0x149] = 0x42 }, noEdit, []string{"unknown RAM size code 0x42"}},
+		{"unknown cart type", func(rom []byte) { rom[0x147] = 0x42 }, noEdit, []string{"unknown cart type 0x42"}},
+		{"unsupported cart type", func(rom []byte) { rom[0x147] = 0x0b }, noEdit, []string{"unsupported cart type MMM01"}},
+		{"several problems", func(rom []byte) { rom[0x104], rom[0x147] = 0, 0x42 }, func(rom []byte) { rom[0x14d]++ },
+			[]string{"logo mismatch", "header checksum mismatch", "global checksum mismatch", "unknown cart type"}},
+	} {
+		rom := testCart(tc.edit)
+		tc.after(rom)
+		ci, err := ParseCartInfo(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := ci.Validate()
+		if len(errs) != len(tc.wantErrs) {
+			t.Errorf("%s: got errors %v, want %d", tc.name, errs, len(tc.wantErrs))
+			continue
+		}
+		for i, want := range tc.wantErrs {
+			if !strings.Contains(errs[i].Error(), want) {
+				t.Errorf("%s: error %d is %q, want it to mention %q", tc.name, i, errs[i], want)
+			}
+		}
+	}
+}
+
+func TestCartInfoNames(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		edit         func(rom []byte)
+		wantType     string
+		wantLicensee string
+	}{
+		{"old licensee code", func(rom []byte) {}, "ROM ONLY", "Nintendo"},
+		{"unknown old licensee code", func(rom []byte) { rom[0x14b] = 0xfa }, "ROM ONLY", "unknown (old code 0xfa)"},
+		{"new licensee code", func(rom []byte) { rom[0x14b] = 0x33; copy(rom[0x144:], "08") }, "ROM ONLY", "Capcom"},
+		// the new code is only used when the old one says so
+		{"new code without 0x33", func(rom []byte) { copy(rom[0x144:], "08") }, "ROM ONLY", "Nintendo"},
+		{"unknown new licensee code", func(rom []byte) { rom[0x14b] = 0x33; copy(rom[0x144:], "ZZ") }, "ROM ONLY", `unknown (new code "ZZ")`},
+		{"mbc5", func(rom []byte) { rom[0x147] = 0x1b }, "MBC5+RAM+BATTERY", "Nintendo"},
+		{"unknown cart type", func(rom []byte) { rom[0x147] = 0x42 }, "unknown (0x42)", "Nintendo"},
+	} {
+		ci, err := ParseCartInfo(testCart(tc.edit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ci.CartridgeTypeName(); got != tc.wantType {
+			t.Errorf("%s: cart type %q, want %q", tc.name, got, tc.wantType)
+		}
+		if got := ci.LicenseeName(); got != tc.wantLicensee {
+			t.Errorf("%s: licensee %q, want %q", tc.name, got, tc.wantLicensee)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ClipRecorder grabs a few seconds of frames for a short looping
+// animation (no sound), to save as a GIF or APNG once it's Done.
+type ClipRecorder struct {
+	frameStep  int
+	maxFrames  int
+	framesSeen int
+	frames     [][]byte
+}
+
+// the DMG's real frame rate, 4194304 clocks per second / 70224 per frame
+const (
+	clipFrameRateNum = 4194304
+	clipFrameRateDen = 70224
+)
+
+// NewClipRecorder makes a recorder for the given number of seconds of
+// gameplay. frameStep keeps every Nth frame: 1 for the full ~59.73fps,
+// 2 for ~30fps, 3 for ~20fps, and so on.
+func NewClipRecorder(seconds float64, frameStep int) *ClipRecorder {
+	if frameStep < 1 {
+		frameStep = 1
+	}
+	maxFrames := int(seconds * clipFrameRateNum / clipFrameRateDen / float64(frameStep))
+	if maxFrames < 1 {
+		maxFrames = 1
+	}
+	return &ClipRecorder{frameStep: frameStep, maxFrames: maxFrames}
+}
+
+// AddFrame should be given every frame from Framebuffer when
+// FlipRequested, and does nothing once the clip is Done
+func (c *ClipRecorder) AddFrame(framebuffer []byte) {
+	if c.Done() {
+		return
+	}
+	if c.framesSeen%c.frameStep == 0 {
+		c.frames = append(c.frames, append([]byte{}, framebuffer...))
+	}
+	c.framesSeen++
+}
+
+// Done is true once the clip has all its frames
+func (c *ClipRecorder) Done() bool {
+	return len(c.frames) >= c.maxFrames
+}
+
+// NumFrames is how many frames the clip has so far
+func (c *ClipRecorder) NumFrames() int {
+	return len(c.frames)
+}
+
+// frame delays in 1/unitsPerSecond, rounded so they add up to the
+// right total instead of drifting
+func (c *ClipRecorder) frameDelays(unitsPerSecond int) []int {
+	delays := make([]int, len(c.frames))
+	perFrame := int64(c.frameStep) * clipFrameRateDen * int64(unitsPerSecond)
+	for i := range delays {
+		start := int64(i) * perFrame / clipFrameRateNum
+		end := int64(i+1) * perFrame / clipFrameRateNum
+		delays[i] = int(end - start)
+	}
+	return delays
+}
+
+// clipPalette is every color in the clip, if there are few enough
+// for one shared palette, or nil
+func (c *ClipRecorder) clipPalette() color.Palette {
+	return exactPalette(c.frames...)
+}
+
+func exactPalette(frames ...[]byte) color.Palette {
+	seen := map[color.RGBA]bool{}
+	pal := color.Palette{}
+	for _, fb := range frames {
+		for i := 0; i < len(fb); i += 4 {
+			col := color.RGBA{fb[i], fb[i+1], fb[i+2], 0xff}
+			if !seen[col] {
+				if len(pal) == 256 {
+					return nil
+				}
+				seen[col] = true
+				pal = append(pal, col)
+			}
+		}
+	}
+	return pal
+}
+
+func palettedFrame(fb []byte, pal color.Palette) *image.Paletted {
+	if pal == nil {
+		// too many colors, e.g. a CGB game changing palettes mid-frame
+		pal = medianCutPalette(fb, 256)
+	}
+	dst := image.NewPaletted(FramebufferImage(fb).Rect, pal)
+	index := map[color.RGBA]uint8{}
+	for i := 0; i < len(fb)/4; i++ {
+		col := color.RGBA{fb[i*4], fb[i*4+1], fb[i*4+2], 0xff}
+		idx, ok := index[col]
+		if !ok {
+			idx = uint8(pal.Index(col))
+			index[col] = idx
+		}
+		dst.Pix[i] = idx
+	}
+	return dst
+}
+
+type colorCount struct {
+	col   color.RGBA
+	count int
+}
+
+func colorChannel(c color.RGBA, ch int) byte {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+type colorBox struct {
+	colors []colorCount
+	// the channel with the biggest spread, and that spread
+	widest, spread int
+}
+
+func newColorBox(colors []colorCount) colorBox {
+	box := colorBox{colors: colors}
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := byte(0xff), byte(0)
+		for _, cc := range colors {
+			v := colorChannel(cc.col, ch)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if spread := int(hi) - int(lo); spread > box.spread {
+			box.widest, box.spread = ch, spread
+		}
+	}
+	return box
+}
+
+// medianCutPalette picks up to size colors for fb from its own colors:
+// the box of colors with the widest spread in any channel is split at
+// its median pixel along that channel until there are size boxes, and
+// each box becomes the average of its pixels.
+func medianCutPalette(fb []byte, size int) color.Palette {
+	counts := map[color.RGBA]int{}
+	for i := 0; i < len(fb); i += 4 {
+		counts[color.RGBA{fb[i], fb[i+1], fb[i+2], 0xff}]++
+	}
+	all := make([]colorCount, 0, len(counts))
+	for col, n := range counts {
+		all = append(all, colorCount{col, n})
+	}
+	// map order is random, and the output shouldn't be
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i].col, all[j].col
+		return a.R < b.R || (a.R == b.R && (a.G < b.G || (a.G == b.G && a.B < b.B)))
+	})
+
+	boxes := []colorBox{newColorBox(all)}
+	for len(boxes) < size {
+		best := 0
+		for i, box := range boxes {
+			if box.spread > boxes[best].spread {
+				best = i
+			}
+		}
+		if boxes[best].spread == 0 {
+			break // every box is down to one color
+		}
+		colors, ch := boxes[best].colors, boxes[best].widest
+		sort.SliceStable(colors, func(i, j int) bool {
+			return colorChannel(colors[i].col, ch) < colorChannel(colors[j].col, ch)
+		})
+		total := 0
+		for _, cc := range colors {
+			total += cc.count
+		}
+		split, seen := 1, colors[0].count
+		for split < len(colors)-1 && seen < total/2 {
+			seen += colors[split].count
+			split++
+		}
+		boxes[best] = newColorBox(colors[:split])
+		boxes = append(boxes, newColorBox(colors[split:]))
+	}
+
+	pal := color.Palette{}
+	for _, box := range boxes {
+		var r, g, b, n int
+		for _, cc := range box.colors {
+			r += int(cc.col.R) * cc.count
+			g += int(cc.col.G) * cc.count
+			b += int(cc.col.B) * cc.count
+			n += cc.count
+		}
+		pal = append(pal, color.RGBA{byte((r + n/2) / n), byte((g + n/2) / n), byte((b + n/2) / n), 0xff})
+	}
+	return pal
+}
+
+// WriteGIF encodes the clip as a looping GIF. The game's own colors are
+// kept exactly (e.g. just 4 on DMG) unless a frame has more than 256.
+// Note GIF delays are in 1/100ths of a second, and most viewers slow
+// down any under 2/100ths, so full speed clips play best at frameStep 2.
+func (c *ClipRecorder) WriteGIF(w io.Writer) error {
+	g := &gif.GIF{}
+	pal := c.clipPalette()
+	if pal != nil {
+		g.Config = image.Config{ColorModel: pal, Width: 160, Height: 144}
+	}
+	delays := c.frameDelays(100)
+	for i, fb := range c.frames {
+		framePal := pal
+		if framePal == nil {
+			framePal = exactPalette(fb)
+		}
+		g.Image = append(g.Image, palettedFrame(fb, framePal))
+		g.Delay = append(g.Delay, delays[i])
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// WriteAPNG encodes the clip as a looping animated PNG, which keeps
+// every color and the exact frame timing.
+func (c *ClipRecorder) WriteAPNG(w io.Writer) error {
+	if len(c.frames) == 0 {
+		return fmt.Errorf("no frames in clip")
+	}
+	pal := c.clipPalette()
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+
+	var ihdr, plte []byte
+	delays := c.frameDelays(1000)
+	seqNum := uint32(0)
+	out := &bytes.Buffer{}
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	for i, fb := range c.frames {
+		var img image.Image = FramebufferImage(fb)
+		if pal != nil {
+			img = palettedFrame(fb, pal)
+		}
+		encoded := &bytes.Buffer{}
+		if err := enc.Encode(encoded, img); err != nil {
+			return err
+		}
+		chunks, err := readPNGChunks(encoded.Bytes())
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			ihdr, plte = chunks["IHDR"], chunks["PLTE"]
+			writePNGChunk(out, "IHDR", ihdr)
+			if plte != nil {
+				writePNGChunk(out, "PLTE", plte)
+			}
+			acTL := make([]byte, 8)
+			binary.BigEndian.PutUint32(acTL[0:], uint32(len(c.frames)))
+			binary.BigEndian.PutUint32(acTL[4:], 0) // loop forever
+			writePNGChunk(out, "acTL", acTL)
+		} else if !bytes.Equal(chunks["IHDR"], ihdr) || !bytes.Equal(chunks["PLTE"], plte) {
+			return fmt.Errorf("apng frame %d encoded differently from the first", i)
+		}
+
+		fcTL := make([]byte, 26)
+		binary.BigEndian.PutUint32(fcTL[0:], seqNum)
+		binary.BigEndian.PutUint32(fcTL[4:], 160)
+		binary.BigEndian.PutUint32(fcTL[8:], 144)
+		// x/y offset 0
+		binary.BigEndian.PutUint16(fcTL[20:], uint16(delays[i]))
+		binary.BigEndian.PutUint16(fcTL[22:], 1000)
+		// dispose op none, blend op source
+		writePNGChunk(out, "fcTL", fcTL)
+		seqNum++
+
+		if i == 0 {
+			writePNGChunk(out, "IDAT", chunks["IDAT"])
+		} else {
+			fdAT := make([]byte, 4, 4+len(chunks["IDAT"]))
+			binary.BigEndian.PutUint32(fdAT, seqNum)
+			writePNGChunk(out, "fdAT", append(fdAT, chunks["IDAT"]...))
+			seqNum++
+		}
+	}
+	writePNGChunk(out, "IEND", nil)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// IDAT chunks come back joined together
+func readPNGChunks(b []byte) (map[string][]byte, error) {
+	const sigLen = 8
+	if len(b) < sigLen {
+		return nil, fmt.Errorf("bad png")
+	}
+	chunks := map[string][]byte{}
+	for i := sigLen; i+12 <= len(b); {
+		size := int(binary.BigEndian.Uint32(b[i:]))
+		if i+12+size > len(b) {
+			return nil, fmt.Errorf("bad png chunk size")
+		}
+		name := string(b[i+4 : i+8])
+		chunks[name] = append(chunks[name], b[i+8:i+8+size]...)
+		i += 12 + size
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w *bytes.Buffer, name string, data []byte) {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	w.Write(size[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	w.WriteString(name)
+	w.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
+
+// ClipFormat picks what WriteClip writes
+type ClipFormat int
+
+const (
+	// ClipGIF is an animated GIF
+	ClipGIF ClipFormat = iota
+	// ClipAPNG is an animated PNG
+	ClipAPNG
+)
+
+var clipFormatNames = map[string]ClipFormat{
+	"gif":  ClipGIF,
+	"apng": ClipAPNG,
+}
+
+// Ext is the file extension for the format, with the dot
+func (cf ClipFormat) Ext() string {
+	if cf == ClipAPNG {
+		return ".png"
+	}
+	return ".gif"
+}
+
+// ClipFormatNames returns the names GetClipFormat accepts, sorted
+func ClipFormatNames() []string {
+	names := []string{}
+	for name := range clipFormatNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetClipFormat looks up a ClipFormat by name, ignoring case
+func GetClipFormat(name string) (ClipFormat, error) {
+	if cf, ok := clipFormatNames[strings.ToLower(name)]; ok {
+		return cf, nil
+	}
+	return 0, fmt.Errorf("unknown clip format %q, choices are: %s", name, strings.Join(ClipFormatNames(), ", "))
+}
+
+// WriteClip writes the clip in the given format
+func (c *ClipRecorder) WriteClip(w io.Writer, format ClipFormat) error {
+	if format == ClipAPNG {
+		return c.WriteAPNG(w)
+	}
+	return c.WriteGIF(w)
+}
@@ -0,0 +1,236 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// a frame of stripes in the given colors, shifted over by offset
+func stripedFrame(colors []RGB, offset int) []byte {
+	fb := make([]byte, 160*144*4)
+	for i := 0; i < 160*144; i++ {
+		c := colors[(i%160/8+offset)%len(colors)]
+		copy(fb[i*4:], []byte{c.R, c.G, c.B, 0xff})
+	}
+	return fb
+}
+
+func TestClipFrameSkipping(t *testing.T) {
+	clip := NewClipRecorder(0.1, 2) // 0.1s is ~6 frames, so 2 kept at every other frame
+	if clip.maxFrames != 2 {
+		t.Fatalf("clip wants %d frames, expected 2", clip.maxFrames)
+	}
+	fb := make([]byte, 160*144*4)
+	for i := 0; i < 10; i++ {
+		fb[0] = byte(i)
+		clip.AddFrame(fb)
+	}
+	if !clip.Done() || clip.NumFrames() != 2 {
+		t.Fatalf("clip has %d frames, done %v", clip.NumFrames(), clip.Done())
+	}
+	for i, want := range []byte{0, 2} {
+		if got := clip.frames[i][0]; got != want {
+			t.Errorf("clip frame %d is source frame %d, want %d", i, got, want)
+		}
+	}
+
+	if clip := NewClipRecorder(0, 0); clip.frameStep != 1 || clip.maxFrames != 1 {
+		t.Errorf("bad args gave step %d, %d frames", clip.frameStep, clip.maxFrames)
+	}
+}
+
+func TestClipFrameDelays(t *testing.T) {
+	for _, step := range []int{1, 2, 3} {
+		for _, units := range []int{100, 1000} {
+			clip := NewClipRecorder(10, step)
+			for i := 0; i < clip.maxFrames; i++ {
+				clip.frames = append(clip.frames, nil)
+			}
+			exact := float64(step) * clipFrameRateDen * float64(units) / clipFrameRateNum
+			total := 0
+			for i, d := range clip.frameDelays(units) {
+				if float64(d) < exact-1 || float64(d) > exact+1 {
+					t.Errorf("step %d, 1/%ds: frame %d delay %d, exact is %v", step, units, i, d, exact)
+				}
+				total += d
+			}
+			// the rounding never drifts more than a unit from the real total
+			want := exact * float64(clip.maxFrames)
+			if float64(total) > want || float64(total) < want-1 {
+				t.Errorf("step %d, 1/%ds: delays add to %d, want %v", step, units, total, want)
+			}
+		}
+	}
+}
+
+func TestClipGIFPalette(t *testing.T) {
+	dmgColors := DefaultDMGPalette.BG[:]
+	clip := NewClipRecorder(2/59.0, 1) // a hair over 2 frames
+	clip.AddFrame(stripedFrame(dmgColors, 0))
+	clip.AddFrame(stripedFrame(dmgColors, 1))
+
+	buf := &bytes.Buffer{}
+	if err := clip.WriteGIF(buf); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 2 {
+		t.Fatalf("gif has %d frames, want 2", len(g.Image))
+	}
+	pal, ok := g.Config.ColorModel.(color.Palette)
+	if !ok || len(pal) != 4 {
+		t.Fatalf("gif global palette has %d colors, want 4", len(pal))
+	}
+	for i, c := range dmgColors {
+		if want := (color.RGBA{c.R, c.G, c.B, 0xff}); pal[i] != want {
+			t.Errorf("palette entry %d is %v, want %v", i, pal[i], want)
+		}
+	}
+	for i, img := range g.Image {
+		want := stripedFrame(dmgColors, i)
+		for y := 0; y < 144; y++ {
+			for x := 0; x < 160; x++ {
+				r, gr, b, _ := img.At(x, y).RGBA()
+				p := want[(y*160+x)*4:]
+				if byte(r>>8) != p[0] || byte(gr>>8) != p[1] || byte(b>>8) != p[2] {
+					t.Fatalf("gif frame %d pixel %d,%d is wrong", i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestClipGIFManyColors(t *testing.T) {
+	colors := []RGB{}
+	for i := 0; i < 300; i++ {
+		colors = append(colors, RGB{byte(i), byte(i >> 1), byte(i * 3)})
+	}
+	fb := make([]byte, 160*144*4)
+	for i := 0; i < 160*144; i++ {
+		c := colors[i%len(colors)]
+		copy(fb[i*4:], []byte{c.R, c.G, c.B, 0xff})
+	}
+	clip := NewClipRecorder(1/59.0, 1)
+	clip.AddFrame(fb)
+	if clip.clipPalette() != nil {
+		t.Errorf("got an exact palette for 300 colors")
+	}
+	buf := &bytes.Buffer{}
+	if err := clip.WriteGIF(buf); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// quantized from the frame's own colors, every pixel should land
+	// close to where it started, with no dithering noise
+	img := g.Image[0]
+	for i := 0; i < 160*144; i++ {
+		r, gr, b, _ := img.At(i%160, i/160).RGBA()
+		got := []int{int(r >> 8), int(gr >> 8), int(b >> 8)}
+		for ch, want := range fb[i*4 : i*4+3] {
+			if d := got[ch] - int(want); d < -8 || d > 8 {
+				t.Fatalf("pixel %d is %v, want close to % x", i, got, fb[i*4:i*4+3])
+			}
+		}
+	}
+}
+
+func TestMedianCutPalette(t *testing.T) {
+	colors := []RGB{}
+	for i := 0; i < 40; i++ {
+		colors = append(colors, RGB{byte(i * 6), byte(255 - i*6), byte(i * i)})
+	}
+	fb := stripedFrame(colors, 0)
+	pal := medianCutPalette(fb, 16)
+	if len(pal) != 16 {
+		t.Fatalf("palette has %d colors, want 16", len(pal))
+	}
+	for i := 0; i < 5; i++ {
+		again := medianCutPalette(fb, 16)
+		for j := range pal {
+			if again[j] != pal[j] {
+				t.Fatalf("palette changed between runs: color %d is %v, then %v", j, pal[j], again[j])
+			}
+		}
+	}
+	// fewer colors than asked for come back as they are
+	few := medianCutPalette(stripedFrame(colors[:3], 0), 16)
+	if len(few) != 3 {
+		t.Errorf("palette of 3 colors has %d entries", len(few))
+	}
+}
+
+func TestClipAPNG(t *testing.T) {
+	dmgColors := DefaultDMGPalette.BG[:]
+	const numFrames = 3
+	clip := NewClipRecorder(numFrames/59.0, 1)
+	for i := 0; i < numFrames; i++ {
+		clip.AddFrame(stripedFrame(dmgColors, i))
+	}
+	buf := &bytes.Buffer{}
+	if err := clip.WriteAPNG(buf); err != nil {
+		t.Fatal(err)
+	}
+	apng := buf.Bytes()
+
+	// plain png decoders show the first frame
+	img, err := png.Decode(bytes.NewReader(apng))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := stripedFrame(dmgColors, 0)
+	for i := 0; i < 160*144; i++ {
+		r, g, b, _ := img.At(i%160, i/160).RGBA()
+		if byte(r>>8) != first[i*4] || byte(g>>8) != first[i*4+1] || byte(b>>8) != first[i*4+2] {
+			t.Fatalf("apng default image pixel %d is wrong", i)
+		}
+	}
+
+	names, seqNums := []string{}, []uint32{}
+	for i := 8; i < len(apng); {
+		size := int(binary.BigEndian.Uint32(apng[i:]))
+		name, data := string(apng[i+4:i+8]), apng[i+8:i+8+size]
+		if crc := binary.BigEndian.Uint32(apng[i+8+size:]); crc != crc32.ChecksumIEEE(apng[i+4:i+8+size]) {
+			t.Errorf("bad crc on %s chunk", name)
+		}
+		switch name {
+		case "acTL":
+			if n := binary.BigEndian.Uint32(data); n != numFrames {
+				t.Errorf("acTL says %d frames, want %d", n, numFrames)
+			}
+		case "fcTL", "fdAT":
+			seqNums = append(seqNums, binary.BigEndian.Uint32(data))
+		}
+		names = append(names, name)
+		i += 12 + size
+	}
+
+	wantNames := []string{"IHDR", "PLTE", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("apng chunks are %v, want %v", names, wantNames)
+	}
+	for i := range names {
+		if names[i] != wantNames[i] {
+			t.Fatalf("apng chunks are %v, want %v", names, wantNames)
+		}
+	}
+	for i, seq := range seqNums {
+		if seq != uint32(i) {
+			t.Errorf("apng sequence numbers are %v, want 0 to %d", seqNums, 2*numFrames-2)
+			break
+		}
+	}
+	if len(seqNums) != 2*numFrames-1 {
+		t.Errorf("apng has %d sequence numbers, want %d", len(seqNums), 2*numFrames-1)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"github.com/theinternetftw/dmgo"
+
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// headless helpers for digging around in roms and snapshots
+
+type command struct {
+	summary string
+	run     func(args []string)
+}
+
+var commands = map[string]command{
+	"tiles":    {"write every tile in VRAM to a png", runTiles},
+	"tilemap":  {"write a whole 256x256 tile map to a png", runTileMap},
+	"oam":      {"print all 40 OAM entries and write them to a png", runOAM},
+	"palettes": {"print the BG/OBJ palettes and write them to a png as swatches", runPalettes},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	cmd.run(os.Args[2:])
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ./dmgo-tools COMMAND [OPTIONS] ROM_FILENAME")
+	fmt.Fprintln(os.Stderr, "commands:")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "run ./dmgo-tools COMMAND -h for a command's options")
+	os.Exit(1)
+}
+
+// emuSource is the flags every command uses to get an emulator in the
+// state to look at: either a snapshot, or the rom run for a while
+type emuSource struct {
+	entryName    *string
+	snapshotFile *string
+	frames       *int
+}
+
+func addEmuSourceFlags(fs *flag.FlagSet) emuSource {
+	return emuSource{
+		entryName:    fs.String("entry", "", "name of the rom to load from a zip/gzip/tar archive (default: first rom found)"),
+		snapshotFile: fs.String("snapshot", "", "snapshot file to load before looking (one made by dmgo with the same rom)"),
+		frames:       fs.Int("frames", -1, "frames to run before looking (default: 0 with -snapshot, 120 without)"),
+	}
+}
+
+func (src emuSource) load(fs *flag.FlagSet) dmgo.Emulator {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	cartFilename := fs.Arg(0)
+	cartBytes, _, err := dmgo.ReadCartFile(cartFilename, *src.entryName)
+	dieIf(err)
+	emu, err := dmgo.NewEmulator(cartBytes, false)
+	dieIf(err)
+
+	frames := *src.frames
+	if *src.snapshotFile != "" {
+		snapBytes, err := ioutil.ReadFile(*src.snapshotFile)
+		dieIf(err)
+		emu, err = emu.LoadSnapshot(snapBytes)
+		dieIf(err)
+		if frames < 0 {
+			frames = 0
+		}
+	} else if frames < 0 {
+		frames = 120
+	}
+
+	// a game that turns the lcd off never flips, so give up after twice
+	// the clocks the frames should take (each Step is at least 4 clocks)
+	maxSteps := frames * 70224 * 2 / 4
+	for framesRun, steps := 0, 0; framesRun < frames; steps++ {
+		if steps == maxSteps {
+			dieIf(fmt.Errorf("only %d of %d frames finished in %d steps, is the lcd off?", framesRun, frames, steps))
+		}
+		emu.Step()
+		dieIf(emu.Err())
+		if emu.FlipRequested() {
+			framesRun++
+		}
+	}
+	return emu
+}
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ./dmgo-tools %s [OPTIONS] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func writePNG(filename string, img image.Image) {
+	f, err := os.Create(filename)
+	dieIf(err)
+	defer f.Close()
+	dieIf(png.Encode(f, img))
+	fmt.Println("wrote", filename)
+}
+
+func viewerPaletteFlag(fs *flag.FlagSet) *string {
+	return fs.String("pal", "bg0", "palette to draw with: bg0-bg7 or obj0-obj7 (on DMG, bg uses BGP and obj0/obj1 use OBP0/OBP1)")
+}
+
+func parseViewerPaletteOrDie(s string) dmgo.ViewerPalette {
+	vp, err := dmgo.ParseViewerPalette(s)
+	dieIf(err)
+	return vp
+}
+
+func runTiles(args []string) {
+	fs := newFlagSet("tiles", "ROM_FILENAME")
+	src := addEmuSourceFlags(fs)
+	pal := viewerPaletteFlag(fs)
+	out := fs.String("o", "tiles.png", "output png filename")
+	fs.Parse(args)
+	vp := parseViewerPaletteOrDie(*pal)
+
+	emu := src.load(fs)
+	writePNG(*out, emu.TilesImage(vp))
+}
+
+func runTileMap(args []string) {
+	fs := newFlagSet("tilemap", "ROM_FILENAME")
+	src := addEmuSourceFlags(fs)
+	mapName := fs.String("map", "bg", "map to draw: bg or window (whichever LCDC says they use), or 9800 or 9c00")
+	overlay := fs.Bool("overlay", true, "outline the screen's viewport (red) and the window (blue)")
+	out := fs.String("o", "tilemap.png", "output png filename")
+	fs.Parse(args)
+	tm, err := dmgo.ParseTileMap(*mapName)
+	dieIf(err)
+
+	emu := src.load(fs)
+	writePNG(*out, emu.TileMapImage(tm, *overlay))
+}
+
+func runOAM(args []string) {
+	fs := newFlagSet("oam", "ROM_FILENAME")
+	src := addEmuSourceFlags(fs)
+	out := fs.String("o", "sprites.png", "output png filename (sprites in OAM order, 8 to a row)")
+	fs.Parse(args)
+
+	emu := src.load(fs)
+	// obp is the DMG palette, cgb the CGB palette and bank
+	fmt.Println(" # |  x    y  | tile flags  | obp | cgb | h  | vis | lines        | dropped")
+	for _, s := range emu.InspectOAM() {
+		vis := "no"
+		if s.Visible {
+			vis = "yes"
+		}
+		flags := ""
+		for _, f := range []struct {
+			on   bool
+			name string
+		}{{s.BehindBG, "b"}, {s.YFlip, "y"}, {s.XFlip, "x"}} {
+			if f.on {
+				flags += f.name
+			} else {
+				flags += "-"
+			}
+		}
+		fmt.Printf("%2d | %4d %4d | %02x   %02x %s | %d   | %d:%d | %-2d | %-3s | %-12s | %s\n",
+			s.Index, s.X, s.Y, s.Tile, s.Flags, flags, s.DMGPalette, s.CGBPalette, s.CGBBank, s.Height, vis, lineRanges(s.Lines), lineRanges(s.DroppedLines))
+	}
+	writePNG(*out, emu.SpriteSheetImage())
+}
+
+func runPalettes(args []string) {
+	fs := newFlagSet("palettes", "ROM_FILENAME")
+	src := addEmuSourceFlags(fs)
+	out := fs.String("o", "palettes.png", "output png filename (BG palettes on the left, OBJ on the right)")
+	fs.Parse(args)
+
+	emu := src.load(fs)
+	// raw is 15-bit BGR colors on CGB, shades 0-3 on DMG
+	fmt.Println("pal  | raw                 | rgb")
+	for _, s := range emu.Palettes() {
+		fmt.Printf("%-4v | %04x %04x %04x %04x | %02x%02x%02x %02x%02x%02x %02x%02x%02x %02x%02x%02x\n",
+			s.Palette, s.Raw[0], s.Raw[1], s.Raw[2], s.Raw[3],
+			s.Colors[0].R, s.Colors[0].G, s.Colors[0].B,
+			s.Colors[1].R, s.Colors[1].G, s.Colors[1].B,
+			s.Colors[2].R, s.Colors[2].G, s.Colors[2].B,
+			s.Colors[3].R, s.Colors[3].G, s.Colors[3].B)
+	}
+	writePNG(*out, emu.PalettesImage())
+}
+
+// e.g. "0-7,20-27"
+func lineRanges(lines []int) string {
+	parts := []string{}
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprint(lines[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
+
+func dieIf(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(err.Error()))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/theinternetftw/dmgo"
+
+	"fmt"
+	"os"
+	"time"
+)
+
+// screenshots and recordings are named after the rom and the time,
+// e.g. game.gb.20060102-150405.png, with a counter added if that name's
+// taken, e.g. game.gb.20060102-150405-2.png. Clips are written in the
+// background, so names handed out are tracked as well as files on disk.
+func (s *sessionState) captureFilename(ext string) string {
+	base := s.capturePrefix + "." + time.Now().Format("20060102-150405")
+	name := base + ext
+	for i := 2; s.captureNameTaken(name); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if s.captureNames == nil {
+		s.captureNames = map[string]bool{}
+	}
+	s.captureNames[name] = true
+	return name
+}
+
+func (s *sessionState) captureNameTaken(name string) bool {
+	if s.captureNames[name] {
+		return true
+	}
+	_, err := os.Lstat(name)
+	return !os.IsNotExist(err)
+}
+
+func (s *sessionState) takeScreenshot() {
+	filename := s.captureFilename(".png")
+	if err := dmgo.SaveScreenshot(filename, s.emu); err != nil {
+		fmt.Println("failed to save screenshot:", err)
+		return
+	}
+	fmt.Println("saved screenshot", filename)
+}
+
+func (s *sessionState) toggleRecording() {
+	if s.recorder != nil {
+		s.stopRecording()
+		return
+	}
+	ext := "" // png sequences get a directory
+	if s.recordFormat == dmgo.RecordAVI {
+		ext = ".avi"
+	}
+	path := s.captureFilename(ext)
+	recorder, err := dmgo.NewRecorder(s.recordFormat, path)
+	if err != nil {
+		fmt.Println("failed to start recording:", err)
+		return
+	}
+	s.recorder = recorder
+	s.emu.SetSoundRecorder(recorder)
+	fmt.Println("recording to", path, "(press r again to stop)")
+}
+
+func (s *sessionState) stopRecording() {
+	err := s.emu.SetSoundRecorder(nil)
+	if closeErr := s.recorder.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Println("failed to finish recording:", err)
+	} else {
+		fmt.Println("recording stopped")
+	}
+	s.recorder = nil
+}
+
+func (s *sessionState) recordErrIf(err error) {
+	if err != nil {
+		fmt.Println("recording failed:", err)
+		s.stopRecording()
+	}
+}
+
+func (s *sessionState) startClip() {
+	if s.clip != nil {
+		fmt.Println("already saving a clip")
+		return
+	}
+	s.clip = dmgo.NewClipRecorder(s.clipSeconds, s.clipFrameStep)
+	fmt.Printf("saving a %v second clip\n", s.clipSeconds)
+}
+
+func (s *sessionState) finishClip() {
+	clip, format, filename := s.clip, s.clipFormat, s.captureFilename(s.clipFormat.Ext())
+	s.clip = nil
+	// encoding takes a moment, so don't hold up the game
+	s.clipsSaving.Add(1)
+	go func() {
+		defer s.clipsSaving.Done()
+		f, err := os.Create(filename)
+		if err == nil {
+			err = clip.WriteClip(f, format)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Println("failed to save clip:", err)
+			return
+		}
+		fmt.Println("saved clip", filename)
+	}()
+}
+
+func (s *sessionState) toggleSoundRecording() {
+	if s.emu.IsRecordingSound() {
+		if err := s.emu.StopSoundRecording(); err != nil {
+			fmt.Println("failed to finish sound recording:", err)
+		} else {
+			fmt.Println("sound recording stopped")
+		}
+		return
+	}
+	filename := s.captureFilename(".wav")
+	if err := s.emu.StartSoundRecording(filename); err != nil {
+		fmt.Println("failed to start sound recording:", err)
+		return
+	}
+	fmt.Println("recording sound to", filename, "(press o again to stop)")
+}
+
+// finishCaptures closes out everything still being written, for when
+// the window closes. A clip that isn't done yet is dropped.
+func (s *sessionState) finishCaptures() {
+	if s.recorder != nil {
+		s.stopRecording()
+	}
+	if s.emu.IsRecordingSound() {
+		s.toggleSoundRecording()
+	}
+	s.clipsSaving.Wait()
+}
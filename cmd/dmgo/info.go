@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/theinternetftw/dmgo"
+
+	"fmt"
+)
+
+func printCartReport(cartFilename string, cartBytes []byte) {
+	cartInfo, err := dmgo.ParseCartInfo(cartBytes)
+	dieIf(err)
+
+	cgbDesc := "DMG only"
+	switch cartInfo.CGBFlag {
+	case 0x80:
+		cgbDesc = "CGB enhanced, DMG compatible"
+	case 0xc0:
+		cgbDesc = "CGB only"
+	}
+	sgbDesc := "no"
+	if cartInfo.SGBFlag == 0x03 {
+		sgbDesc = "yes"
+	}
+	destDesc := "Japan"
+	if cartInfo.DestinationCode != 0 {
+		destDesc = "Overseas"
+	}
+
+	fmt.Printf("File:              %s (%d bytes)\n", cartFilename, len(cartBytes))
+	fmt.Printf("Title:             %q\n", cartInfo.Title)
+	if cartInfo.ManufacturerCode != "" {
+		fmt.Printf("Manufacturer code: %q\n", cartInfo.ManufacturerCode)
+	}
+	fmt.Printf("CGB flag:          0x%02x (%s)\n", cartInfo.CGBFlag, cgbDesc)
+	fmt.Printf("SGB flag:          0x%02x (%s)\n", cartInfo.SGBFlag, sgbDesc)
+	fmt.Printf("Cart type:         0x%02x (%s)\n", cartInfo.CartridgeType, cartInfo.CartridgeTypeName())
+	if romSize, err := cartInfo.GetROMSize(); err == nil {
+		fmt.Printf("ROM size:          0x%02x (%d KB)\n", cartInfo.ROMSizeCode, romSize/1024)
+	} else {
+		fmt.Printf("ROM size:          0x%02x (unknown)\n", cartInfo.ROMSizeCode)
+	}
+	if ramSize, err := cartInfo.GetRAMSize(); err == nil {
+		fmt.Printf("RAM size:          0x%02x (%d bytes)\n", cartInfo.RAMSizeCode, ramSize)
+	} else {
+		fmt.Printf("RAM size:          0x%02x (unknown)\n", cartInfo.RAMSizeCode)
+	}
+	fmt.Printf("Destination:       0x%02x (%s)\n", cartInfo.DestinationCode, destDesc)
+	if cartInfo.OldLicenseeCode == 0x33 {
+		fmt.Printf("Licensee:          new code %q (%s)\n", cartInfo.NewLicenseeCode, cartInfo.LicenseeName())
+	} else {
+		fmt.Printf("Licensee:          old code 0x%02x (%s)\n", cartInfo.OldLicenseeCode, cartInfo.LicenseeName())
+	}
+	fmt.Printf("Version:           0x%02x\n", cartInfo.MaskRomVersion)
+	fmt.Printf("Header checksum:   0x%02x (computed 0x%02x)\n", cartInfo.HeaderChecksum, cartInfo.ComputedHeaderChecksum())
+	fmt.Printf("Global checksum:   0x%04x (computed 0x%04x)\n", cartInfo.GlobalChecksum, cartInfo.ComputedGlobalChecksum())
+
+	if errs := cartInfo.Validate(); len(errs) > 0 {
+		fmt.Println()
+		fmt.Println("Problems found:")
+		for _, err := range errs {
+			fmt.Println("  -", err)
+		}
+	} else {
+		fmt.Println()
+		fmt.Println("Header OK")
+	}
+}
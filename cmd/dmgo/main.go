@@ -3,14 +3,17 @@ package main
 import (
 	"github.com/theinternetftw/dmgo"
 	"github.com/theinternetftw/dmgo/profiling"
+	"github.com/theinternetftw/dmgo/scale"
 	"github.com/theinternetftw/glimmer"
 
-	"archive/zip"
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,20 +21,60 @@ func main() {
 
 	defer profiling.Start().Stop()
 
-	assert(len(os.Args) == 2, "usage: ./dmgo ROM_FILENAME")
-	cartFilename := os.Args[1]
+	var patchFilenames stringListFlag
+	flag.Var(&patchFilenames, "patch", "IPS/UPS/BPS patch to apply to the rom (can be repeated, applied in order)")
+	entryName := flag.String("entry", "", "name of the rom to load from a zip/gzip/tar archive (default: first rom found)")
+	paletteName := flag.String("palette", "grey", "colors for DMG games: "+strings.Join(dmgo.DMGPalettePresetNames(), ", ")+", or cgb (the CGB boot rom's per-game colors)")
+	lcdResponseName := flag.String("ghosting", "off", "LCD ghosting, for games that flicker sprites: "+strings.Join(dmgo.LCDResponsePresetNames(), ", "))
+	colorCorrectionName := flag.String("color-correction", dmgo.DefaultColorCorrection.String(), "how CGB game colors are adjusted: "+strings.Join(dmgo.ColorCorrectionNames(), ", "))
+	noSpriteLimit := flag.Bool("no-sprite-limit", false, "draw every sprite on a line instead of just the first 10 (less flicker, but not accurate)")
+	scalerName := flag.String("scale", "none", "upscaling filter: "+strings.Join(scale.Names(), ", "))
+	clipFormatName := flag.String("clip-format", "gif", "what pressing g saves a short clip as: gif or apng")
+	clipSeconds := flag.Float64("clip-seconds", 5, "length of clips saved by pressing g")
+	clipFPS := flag.Int("clip-fps", 60, "frame rate of clips: 60 (the real ~59.73), 30, or 20 (gifs under 30 play slow in most browsers)")
+	recordFormatName := flag.String("record-format", "avi", "what pressing r records to: avi (uncompressed, with sound) or png (a directory of frames plus audio.wav)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ./dmgo [OPTIONS] ROM_FILENAME")
+		fmt.Fprintln(os.Stderr, "       ./dmgo [OPTIONS] info ROM_FILENAME")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	var cartBytes []byte
-	var err error
-	if strings.HasSuffix(cartFilename, ".zip") {
-		cartBytes = readZipFileOrDie(cartFilename)
-	} else {
-		cartBytes, err = ioutil.ReadFile(cartFilename)
-		dieIf(err)
+	args := flag.Args()
+	infoMode := len(args) == 2 && args[0] == "info"
+	if infoMode {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cartFilename := args[0]
+
+	cartBytes, cartEntryName, err := dmgo.ReadCartFile(cartFilename, *entryName)
+	dieIf(err)
+	if cartEntryName != cartFilename {
+		fmt.Printf("loading %q from archive\n", cartEntryName)
+	}
+	cartBytes = applyPatchesOrDie(cartFilename, cartBytes, patchFilenames)
+
+	if infoMode {
+		printCartReport(cartFilename, cartBytes)
+		return
 	}
 
 	assert(len(cartBytes) > 3, "cannot parse, file is too small")
 
+	scaler, err := scale.Get(*scalerName)
+	dieIf(err)
+	recordFormat, err := dmgo.GetRecordingFormat(*recordFormatName)
+	dieIf(err)
+	clipFormat, err := dmgo.GetClipFormat(*clipFormatName)
+	dieIf(err)
+	if *clipFPS != 60 && *clipFPS != 30 && *clipFPS != 20 {
+		dieIf(fmt.Errorf("bad -clip-fps %d, must be 60, 30, or 20", *clipFPS))
+	}
+
 	// TODO: config file instead
 	devMode := fileExists("devmode")
 
@@ -45,16 +88,31 @@ func main() {
 	} else {
 		// rom file
 
-		cartInfo := dmgo.ParseCartInfo(cartBytes)
 		if devMode {
-			fmt.Printf("Game title: %q\n", cartInfo.Title)
-			fmt.Printf("Cart type: %d\n", cartInfo.CartridgeType)
-			fmt.Printf("Cart RAM size: %d\n", cartInfo.GetRAMSize())
-			fmt.Printf("Cart ROM size: %d\n", cartInfo.GetROMSize())
+			printCartReport(cartFilename, cartBytes)
 		}
 
-		emu = dmgo.NewEmulator(cartBytes, devMode)
-		windowTitle = fmt.Sprintf("dmgo - %q", cartInfo.Title)
+		colorCorrection, err := dmgo.GetColorCorrection(*colorCorrectionName)
+		dieIf(err)
+		lcdResponse, err := dmgo.GetLCDResponsePreset(*lcdResponseName)
+		dieIf(err)
+
+		emu, err = dmgo.NewEmulator(cartBytes, devMode)
+		if err != nil {
+			emu = dmgo.NewErrEmu(fmt.Sprintf("could not load rom\n%s", err.Error()))
+		} else if cartInfo, err := dmgo.ParseCartInfo(cartBytes); err == nil {
+			windowTitle = fmt.Sprintf("dmgo - %q", cartInfo.Title)
+			if *paletteName == "cgb" {
+				emu.SetDMGPalette(cartInfo.CGBColorizationPalette())
+			} else {
+				pal, err := dmgo.GetDMGPalettePreset(*paletteName)
+				dieIf(err)
+				emu.SetDMGPalette(pal)
+			}
+		}
+		emu.SetColorCorrection(colorCorrection)
+		emu.SetLCDResponse(lcdResponse)
+		emu.SetSpriteLimit(!*noSpriteLimit)
 	}
 
 	snapshotPrefix := cartFilename + ".snapshot"
@@ -69,9 +127,29 @@ func main() {
 		}
 	}
 
+	// closing the window (or ctrl-c) ends the process, so the emu loop
+	// is told to finish any recordings first, and given a moment to
+	quit, finished := make(chan struct{}), make(chan struct{})
+	var quitOnce sync.Once
+	shutdown := func() {
+		quitOnce.Do(func() { close(quit) })
+		select {
+		case <-finished:
+		case <-time.After(10 * time.Second):
+			fmt.Println("timed out finishing recordings")
+		}
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		shutdown()
+		os.Exit(1)
+	}()
+
 	glimmer.InitDisplayLoop(glimmer.InitDisplayLoopOptions{
 		WindowTitle: windowTitle,
-		RenderWidth: 160, RenderHeight: 144,
+		RenderWidth: 160 * scaler.Factor, RenderHeight: 144 * scaler.Factor,
 		WindowWidth: 160 * 4, WindowHeight: 144 * 4,
 		InitCallback: func(sharedState *glimmer.WindowState) {
 
@@ -85,17 +163,27 @@ func main() {
 
 			session := sessionState{
 				snapshotPrefix:    snapshotPrefix,
+				capturePrefix:     cartFilename,
+				recordFormat:      recordFormat,
+				clipFormat:        clipFormat,
+				clipSeconds:       *clipSeconds,
+				clipFrameStep:     60 / *clipFPS,
 				saveFilename:      saveFilename,
 				frameTimer:        glimmer.MakeFrameTimer(),
 				lastSaveTime:      time.Now(),
 				lastInputPollTime: time.Now(),
 				audio:             audio,
 				emu:               emu,
+				scaler:            scaler,
+				quit:              quit,
 			}
 
 			runEmu(&session, sharedState)
+			session.finishCaptures()
+			close(finished)
 		},
 	})
+	shutdown()
 }
 
 type sessionState struct {
@@ -110,8 +198,25 @@ type sessionState struct {
 	ticksSincePollingInput int
 	lastSaveRAM            []byte
 	emu                    dmgo.Emulator
+	scaler                 scale.Scaler
+	viewIndex              int
+	viewKeyWasDown         bool
+	capturePrefix          string
+	captureNames           map[string]bool
+	recordFormat           dmgo.RecordingFormat
+	recorder               dmgo.Recorder
+	screenshotKeyWasDown   bool
+	recordKeyWasDown       bool
+	clipFormat             dmgo.ClipFormat
+	clipSeconds            float64
+	clipFrameStep          int
+	clip                   *dmgo.ClipRecorder
+	clipKeyWasDown         bool
+	soundRecordKeyWasDown  bool
 	currentNumFrames       int
 	audioBytesProduced     int
+	quit                   chan struct{}
+	clipsSaving            sync.WaitGroup
 }
 
 func runEmu(session *sessionState, window *glimmer.WindowState) {
@@ -127,6 +232,11 @@ func runEmu(session *sessionState, window *glimmer.WindowState) {
 		session.ticksSincePollingInput++
 		if session.ticksSincePollingInput == 100 {
 			session.ticksSincePollingInput = 0
+			select {
+			case <-session.quit:
+				return
+			default:
+			}
 			now := time.Now()
 
 			inputDiff := now.Sub(session.lastInputPollTime)
@@ -136,6 +246,7 @@ func runEmu(session *sessionState, window *glimmer.WindowState) {
 
 				window.InputMutex.Lock()
 				var numDown rune
+				var screenshotPressed, recordPressed, clipPressed, soundRecordPressed bool
 				{
 					bDown := window.CharIsDown('b')
 					session.latestInput = dmgo.Input{
@@ -158,6 +269,24 @@ func runEmu(session *sessionState, window *glimmer.WindowState) {
 							break
 						}
 					}
+					viewKeyDown := window.CharIsDown('v')
+					if viewKeyDown && !session.viewKeyWasDown {
+						session.viewIndex = (session.viewIndex + 1) % len(debugViews)
+						fmt.Println("view:", debugViews[session.viewIndex].name)
+					}
+					session.viewKeyWasDown = viewKeyDown
+
+					screenshotKeyDown, recordKeyDown := window.CharIsDown('p'), window.CharIsDown('r')
+					screenshotPressed = screenshotKeyDown && !session.screenshotKeyWasDown
+					recordPressed = recordKeyDown && !session.recordKeyWasDown
+					session.screenshotKeyWasDown, session.recordKeyWasDown = screenshotKeyDown, recordKeyDown
+					clipKeyDown := window.CharIsDown('g')
+					clipPressed = clipKeyDown && !session.clipKeyWasDown
+					session.clipKeyWasDown = clipKeyDown
+					soundRecordKeyDown := window.CharIsDown('o')
+					soundRecordPressed = soundRecordKeyDown && !session.soundRecordKeyWasDown
+					session.soundRecordKeyWasDown = soundRecordKeyDown
+
 					if window.CharIsDown('m') {
 						session.snapshotMode = 'm'
 					} else if window.CharIsDown('l') {
@@ -168,6 +297,19 @@ func runEmu(session *sessionState, window *glimmer.WindowState) {
 				}
 				window.InputMutex.Unlock()
 
+				if screenshotPressed {
+					session.takeScreenshot()
+				}
+				if recordPressed {
+					session.toggleRecording()
+				}
+				if clipPressed {
+					session.startClip()
+				}
+				if soundRecordPressed {
+					session.toggleSoundRecording()
+				}
+
 				if numDown > '0' && numDown <= '9' {
 					snapFilename := session.snapshotPrefix + string(numDown)
 					if session.snapshotMode == 'm' {
@@ -199,19 +341,47 @@ func runEmu(session *sessionState, window *glimmer.WindowState) {
 		} else {
 			session.emu.Step()
 		}
+		if emuErr := session.emu.Err(); emuErr != nil {
+			ram := session.emu.GetCartRAM()
+			if len(ram) > 0 && !bytes.Equal(ram, session.lastSaveRAM) {
+				ioutil.WriteFile(session.saveFilename, ram, os.FileMode(0644))
+			}
+			if session.emu.IsRecordingSound() {
+				session.toggleSoundRecording()
+			}
+			if session.recorder != nil {
+				session.stopRecording()
+			}
+			session.emu = dmgo.NewErrEmu(fmt.Sprintf("emulation stopped\n%s", emuErr.Error()))
+		}
 		bufInfo := session.emu.GetSoundBufferInfo()
 		if bufInfo.IsValid && bufInfo.UsedSize >= audioToGen {
 			if cap(audioChunkBuf) < audioToGen {
 				audioChunkBuf = make([]byte, audioToGen)
 			}
-			session.audio.Write(session.emu.ReadSoundBuffer(audioChunkBuf[:audioToGen]))
+			samples := session.emu.ReadSoundBuffer(audioChunkBuf[:audioToGen])
+			session.audio.Write(samples)
 		}
 
 		if session.emu.FlipRequested() {
 			window.RenderMutex.Lock()
-			copy(window.Pix, session.emu.Framebuffer())
+			if view := debugViews[session.viewIndex]; view.draw != nil {
+				drawFitted(window.Pix, window.RenderWidth, window.RenderHeight, view.draw(session.emu))
+			} else {
+				session.scaler.Scale(window.Pix, session.emu.Framebuffer(), 160, 144)
+			}
 			window.RenderMutex.Unlock()
 
+			if session.recorder != nil {
+				session.recordErrIf(session.recorder.WriteFrame(session.emu.Framebuffer()))
+			}
+			if session.clip != nil {
+				session.clip.AddFrame(session.emu.Framebuffer())
+				if session.clip.Done() {
+					session.finishClip()
+				}
+			}
+
 			session.frameTimer.MarkRenderComplete()
 
 			session.currentNumFrames++
@@ -256,23 +426,6 @@ func dieIf(err error) {
 	}
 }
 
-func readZipFileOrDie(filename string) []byte {
-	zipReader, err := zip.OpenReader(filename)
-	dieIf(err)
-
-	// TODO: make list of filenames, sort abc, grab first alpha-sorted file with .gb or .gbc in name
-	f := zipReader.File[0]
-	fmt.Printf("unzipping first file found: %q\n", f.FileHeader.Name)
-	cartReader, err := f.Open()
-	dieIf(err)
-	cartBytes, err := ioutil.ReadAll(cartReader)
-	dieIf(err)
-
-	cartReader.Close()
-	zipReader.Close()
-	return cartBytes
-}
-
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
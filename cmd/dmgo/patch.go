@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/theinternetftw/dmgo"
+
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+type stringListFlag []string
+
+func (s *stringListFlag) String() string { return strings.Join(*s, ",") }
+func (s *stringListFlag) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
+
+var patchExtensions = []string{".ips", ".ups", ".bps"}
+
+// findPatchFile looks for e.g. game.ips next to game.gb
+func findPatchFile(cartFilename string) string {
+	base := strings.TrimSuffix(cartFilename, filepath.Ext(cartFilename))
+	for _, ext := range patchExtensions {
+		if fileExists(base + ext) {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+func applyPatchesOrDie(cartFilename string, cartBytes []byte, patchFilenames []string) []byte {
+	if len(patchFilenames) == 0 {
+		if found := findPatchFile(cartFilename); found != "" {
+			patchFilenames = []string{found}
+		}
+	}
+	for _, patchFilename := range patchFilenames {
+		patchBytes, err := ioutil.ReadFile(patchFilename)
+		dieIf(err)
+		cartBytes, err = dmgo.ApplyPatch(cartBytes, patchBytes)
+		if err != nil {
+			dieIf(fmt.Errorf("could not apply %q: %v", patchFilename, err))
+		}
+		fmt.Printf("applied patch %q\n", patchFilename)
+	}
+	return cartBytes
+}
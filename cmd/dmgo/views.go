@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/theinternetftw/dmgo"
+
+	"image"
+)
+
+// debug views take over the window in place of the game screen,
+// cycled through with the v key
+type debugView struct {
+	name string
+	draw func(emu dmgo.Emulator) *image.RGBA
+}
+
+var debugViews = []debugView{
+	{name: "screen"},
+	{name: "vram tiles", draw: func(emu dmgo.Emulator) *image.RGBA {
+		return emu.TilesImage(dmgo.ViewerPalette{})
+	}},
+	{name: "bg tile map", draw: func(emu dmgo.Emulator) *image.RGBA {
+		return emu.TileMapImage(dmgo.TileMapBG, true)
+	}},
+	{name: "window tile map", draw: func(emu dmgo.Emulator) *image.RGBA {
+		return emu.TileMapImage(dmgo.TileMapWindow, true)
+	}},
+	{name: "sprites", draw: func(emu dmgo.Emulator) *image.RGBA {
+		return emu.SpriteSheetImage()
+	}},
+	{name: "palettes", draw: func(emu dmgo.Emulator) *image.RGBA {
+		return emu.PalettesImage()
+	}},
+}
+
+// drawFitted draws img as big as it'll fit in dst (by whole multiples
+// when it can), centered, with a black border
+func drawFitted(dst []byte, dstW, dstH int, img *image.RGBA) {
+	for i := range dst {
+		dst[i] = 0
+		if i&3 == 3 {
+			dst[i] = 0xff
+		}
+	}
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	if srcW == 0 || srcH == 0 {
+		return
+	}
+	// scale is num/den, whole if possible, shrink to fit otherwise
+	num, den := dstW/srcW, 1
+	if dstH/srcH < num {
+		num = dstH / srcH
+	}
+	if num == 0 {
+		num, den = dstW, srcW
+		if dstH*srcW < dstW*srcH {
+			num, den = dstH, srcH
+		}
+	}
+	outW, outH := srcW*num/den, srcH*num/den
+	offX, offY := (dstW-outW)/2, (dstH-outH)/2
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			si := img.PixOffset(img.Rect.Min.X+x*den/num, img.Rect.Min.Y+y*den/num)
+			di := ((offY+y)*dstW + offX + x) * 4
+			copy(dst[di:di+4], img.Pix[si:si+4])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dmgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// ColorCorrection picks how CGB 15-bit colors are turned into display colors
+type ColorCorrection int
+
+const (
+	// ColorCorrectionRaw shifts each 5-bit channel up by 3 (so white is 248,248,248)
+	ColorCorrectionRaw ColorCorrection = iota
+	// ColorCorrectionExpand repeats each channel's top bits in its low bits, so 31 maps to 255
+	ColorCorrectionExpand
+	// ColorCorrectionCGB mimics the CGB's LCD, which mixes channels and
+	// is much less saturated than a modern screen
+	ColorCorrectionCGB
+	// ColorCorrectionGBA mimics CGB games on the GBA's darker, unlit screen
+	ColorCorrectionGBA
+)
+
+var colorCorrectionNames = []string{"raw", "expand", "cgb", "gba"}
+
+func (cc ColorCorrection) String() string {
+	if cc >= 0 && int(cc) < len(colorCorrectionNames) {
+		return colorCorrectionNames[cc]
+	}
+	return fmt.Sprintf("ColorCorrection(%d)", int(cc))
+}
+
+// ColorCorrectionNames lists the names accepted by GetColorCorrection
+func ColorCorrectionNames() []string {
+	return append([]string{}, colorCorrectionNames...)
+}
+
+// GetColorCorrection looks up a color correction mode by name (case-insensitive)
+func GetColorCorrection(name string) (ColorCorrection, error) {
+	for i, ccName := range colorCorrectionNames {
+		if strings.EqualFold(name, ccName) {
+			return ColorCorrection(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown color correction %q, choices are: %s", name, strings.Join(colorCorrectionNames, ", "))
+}
+
+// DefaultColorCorrection is what CGB games are shown with unless told
+// otherwise. It's raw, i.e. no correction, so existing output is unchanged.
+const DefaultColorCorrection = ColorCorrectionRaw
+
+func cgbToRGB(cgbColor uint16, cc ColorCorrection) (byte, byte, byte) {
+	r := byte(cgbColor & 0x1f)
+	g := byte(cgbColor>>5) & 0x1f
+	b := byte(cgbColor>>10) & 0x1f
+	switch cc {
+	case ColorCorrectionExpand:
+		return r<<3 | r>>2, g<<3 | g>>2, b<<3 | b>>2
+	case ColorCorrectionCGB:
+		cgbColorTableOnce.Do(func() { cgbColorTable = makeColorTable(cgbLCDColor) })
+		c := cgbColorTable[cgbColor&0x7fff]
+		return c.R, c.G, c.B
+	case ColorCorrectionGBA:
+		gbaColorTableOnce.Do(func() { gbaColorTable = makeColorTable(gbaLCDColor) })
+		c := gbaColorTable[cgbColor&0x7fff]
+		return c.R, c.G, c.B
+	}
+	return r << 3, g << 3, b << 3
+}
+
+// the gamma math is too slow to do per pixel, so each
+// mode gets a full table, built the first time it's used
+var (
+	cgbColorTable     []RGB
+	cgbColorTableOnce sync.Once
+	gbaColorTable     []RGB
+	gbaColorTableOnce sync.Once
+)
+
+func makeColorTable(convert func(r, g, b float64) (float64, float64, float64)) []RGB {
+	table := make([]RGB, 0x8000)
+	for i := range table {
+		r := float64(i&0x1f) / 31
+		g := float64((i>>5)&0x1f) / 31
+		b := float64((i>>10)&0x1f) / 31
+		outR, outG, outB := convert(r, g, b)
+		table[i] = RGB{unitToByte(outR), unitToByte(outG), unitToByte(outB)}
+	}
+	return table
+}
+
+func unitToByte(f float64) byte {
+	if f <= 0 {
+		return 0
+	}
+	if f >= 1 {
+		return 0xff
+	}
+	return byte(f*255 + 0.5)
+}
+
+// Go to linear light, mix the channels the way the CGB's LCD bleeds
+// them together, dim a little, then back to display gamma.
+func cgbLCDColor(r, g, b float64) (float64, float64, float64) {
+	const lcdGamma, displayGamma, lum = 2.2, 2.2, 0.94
+	r = math.Pow(r, lcdGamma) * lum
+	g = math.Pow(g, lcdGamma) * lum
+	b = math.Pow(b, lcdGamma) * lum
+	outR := 0.82*r + 0.24*g - 0.06*b
+	outG := 0.125*r + 0.665*g + 0.21*b
+	outB := 0.195*r + 0.075*g + 0.73*b
+	return gammaOut(outR, displayGamma), gammaOut(outG, displayGamma), gammaOut(outB, displayGamma)
+}
+
+// The GBA's screen is unlit and much darker, which games written for
+// it compensate for by being very bright. The high lcd gamma darkens
+// everything but the brightest colors.
+func gbaLCDColor(r, g, b float64) (float64, float64, float64) {
+	const lcdGamma, displayGamma = 4.0, 2.2
+	r = math.Pow(r, lcdGamma)
+	g = math.Pow(g, lcdGamma)
+	b = math.Pow(b, lcdGamma)
+	outR := (50*g + 255*r) / 255
+	outG := (30*b + 230*g + 10*r) / 255
+	outB := (220*b + 10*g + 50*r) / 255
+	const scale = 255.0 / 280
+	return gammaOut(outR, displayGamma) * scale, gammaOut(outG, displayGamma) * scale, gammaOut(outB, displayGamma) * scale
+}
+
+func gammaOut(f, gamma float64) float64 {
+	if f <= 0 {
+		return 0
+	}
+	return math.Pow(f, 1/gamma)
+}
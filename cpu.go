@@ -79,3 +79,55 @@ func (cs *cpuState) setHL(val uint16) { cs.H, cs.L = byte(val>>8), byte(val) }
 
 func (cs *cpuState) setSP(val uint16) { cs.SP = val }
 func (cs *cpuState) setPC(val uint16) { cs.PC = val }
+
+// Registers is a snapshot of the CPU-visible register state
+type Registers struct {
+	PC, SP         uint16
+	AF, BC, DE, HL uint16
+
+	// IME is the interrupt master enable flag
+	IME bool
+	// IE and IF are the interrupt enable (0xffff) and flag (0xff0f) regs
+	IE, IF byte
+
+	InHaltMode bool
+	InStopMode bool
+	// FastMode is the CGB double-speed flag
+	FastMode bool
+}
+
+// Registers returns the current register state
+func (cs *cpuState) Registers() Registers {
+	return Registers{
+		PC:         cs.PC,
+		SP:         cs.SP,
+		AF:         cs.getAF(),
+		BC:         cs.getBC(),
+		DE:         cs.getDE(),
+		HL:         cs.getHL(),
+		IME:        cs.InterruptMasterEnable,
+		IE:         cs.readInterruptEnableReg(),
+		IF:         cs.readInterruptFlagReg(),
+		InHaltMode: cs.InHaltMode,
+		InStopMode: cs.InStopMode,
+		FastMode:   cs.FastMode,
+	}
+}
+
+// SetRegisters overwrites the register state. Note that, as on
+// hardware, the low nibble of F and the top bits of IF can't be set.
+func (cs *cpuState) SetRegisters(regs Registers) {
+	cs.setPC(regs.PC)
+	cs.setSP(regs.SP)
+	cs.setAF(regs.AF)
+	cs.setBC(regs.BC)
+	cs.setDE(regs.DE)
+	cs.setHL(regs.HL)
+	cs.InterruptMasterEnable = regs.IME
+	cs.MasterEnableRequested = false
+	cs.writeInterruptEnableReg(regs.IE)
+	cs.writeInterruptFlagReg(regs.IF)
+	cs.InHaltMode = regs.InHaltMode
+	cs.InStopMode = regs.InStopMode
+	cs.FastMode = regs.FastMode
+}
@@ -0,0 +1,39 @@
+package dmgo
+
+import "testing"
+
+func TestRegistersRoundTrip(t *testing.T) {
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		set  Registers
+		want Registers
+	}{
+		{
+			"everything set",
+			Registers{PC: 0x1234, SP: 0xfffe, AF: 0xabf0, BC: 0x0102, DE: 0x0304, HL: 0x0506,
+				IME: true, IE: 0xff, IF: 0x1f, InHaltMode: true, InStopMode: true, FastMode: true},
+			Registers{PC: 0x1234, SP: 0xfffe, AF: 0xabf0, BC: 0x0102, DE: 0x0304, HL: 0x0506,
+				IME: true, IE: 0xff, IF: 0xff, InHaltMode: true, InStopMode: true, FastMode: true},
+		},
+		{
+			// F's low nibble and IF's top bits always read as 0 and 1
+			"unsettable bits",
+			Registers{PC: 0x150, SP: 0xdff0, AF: 0x12ff, IE: 0x05, IF: 0x01},
+			Registers{PC: 0x150, SP: 0xdff0, AF: 0x12f0, IE: 0x05, IF: 0xe1},
+		},
+		{
+			"all clear",
+			Registers{},
+			Registers{IF: 0xe0},
+		},
+	} {
+		emu.SetRegisters(tc.set)
+		if got := emu.Registers(); got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
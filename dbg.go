@@ -49,6 +49,11 @@ type debugger struct {
 	lineBuf         []byte
 	state           int
 	breakpoints     []breakpoint
+
+	// for the trace helpers used in cpuState.step()
+	lastSP      uint16
+	lastSPValid bool
+	hitTarget   bool
 }
 
 func lookupValue(root reflect.Value, lookups []string) (reflect.Value, bool) {
@@ -157,6 +162,60 @@ var dbgCmdMap = map[string]func(*debugger, Emulator, []string){
 		bp := breakpoint{fieldPath: arg[0], op: op, breakVal: valStr}
 		d.breakpoints = append(d.breakpoints, bp)
 	},
+	"layer": func(d *debugger, emu Emulator, arg []string) {
+		if len(arg) != 2 || (arg[1] != "on" && arg[1] != "off") {
+			fmt.Println("usage: layer bg|window|sprites on|off")
+			return
+		}
+		layer := strIndexOf(renderLayerNames, arg[0])
+		if layer < 0 {
+			fmt.Println("unknown layer", arg[0])
+			return
+		}
+		emu.SetLayerVisible(RenderLayer(layer), arg[1] == "on")
+	},
+	"sprite": func(d *debugger, emu Emulator, arg []string) {
+		if len(arg) != 2 || (arg[1] != "on" && arg[1] != "off") {
+			fmt.Println("usage: sprite OAM_INDEX on|off")
+			return
+		}
+		var index int
+		if _, err := fmt.Sscan(arg[0], &index); err != nil || index < 0 || index >= 40 {
+			fmt.Println("bad OAM_INDEX, must be 0-39")
+			return
+		}
+		emu.SetSpriteVisible(index, arg[1] == "on")
+	},
+	"pal": func(d *debugger, emu Emulator, arg []string) {
+		if len(arg) == 0 {
+			for _, s := range emu.Palettes() {
+				fmt.Printf("%-4v %04x %04x %04x %04x\n", s.Palette, s.Raw[0], s.Raw[1], s.Raw[2], s.Raw[3])
+			}
+			return
+		}
+		if len(arg) != 3 {
+			fmt.Println("usage: pal [PALETTE COLOR_INDEX HEX_VALUE], e.g. pal bg2 1 7fff (no args lists them)")
+			return
+		}
+		vp, err := ParseViewerPalette(arg[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var index int
+		var value uint16
+		if _, err := fmt.Sscan(arg[1], &index); err != nil {
+			fmt.Println("bad COLOR_INDEX, must be 0-3")
+			return
+		}
+		if _, err := fmt.Sscanf(arg[2], "%x", &value); err != nil {
+			fmt.Println("bad HEX_VALUE", arg[2])
+			return
+		}
+		if err := emu.SetPaletteColor(vp, index, value); err != nil {
+			fmt.Println(err)
+		}
+	},
 	"call": func(d *debugger, emu Emulator, arg []string) {
 		if len(arg) == 0 {
 			fmt.Println("usage: call METHOD_PATH")
@@ -0,0 +1,270 @@
+package dmgo
+
+import "testing"
+
+// newOAMDMATestState fills wram at 0xc000 and 0xd000 with two different
+// patterns, clears OAM, and lines up on an M-cycle so each runCycles(4)
+// is one DMA step
+func newOAMDMATestState(t *testing.T) *cpuState {
+	t.Helper()
+	cs, err := newState(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint16(0); i < 0xa0; i++ {
+		cs.write(0xc000+i, byte(i+1))
+		cs.write(0xd000+i, byte(0xff-i))
+	}
+	for i := range cs.LCD.OAM {
+		cs.LCD.OAM[i] = 0
+	}
+	for cs.Cycles&3 != 0 {
+		cs.runCycles(1)
+	}
+	return cs
+}
+
+func runMCycles(cs *cpuState, n int) {
+	for i := 0; i < n; i++ {
+		cs.runCycles(4)
+	}
+}
+
+func TestOAMDMATiming(t *testing.T) {
+	cs := newOAMDMATestState(t)
+	cs.write(0xff46, 0xc0)
+
+	// first M-cycle is the startup delay
+	runMCycles(cs, 1)
+	if cs.OAMDMAActive || cs.LCD.OAM[0] != 0 {
+		t.Fatalf("after 1 M-cycle: active %v, OAM[0] 0x%02x, want nothing copied yet", cs.OAMDMAActive, cs.LCD.OAM[0])
+	}
+	// then one byte per M-cycle
+	for i := 0; i < 0xa0; i++ {
+		runMCycles(cs, 1)
+		if !cs.OAMDMAActive && i < 0x9f {
+			t.Fatalf("after byte %d: DMA stopped early", i)
+		}
+		if cs.LCD.OAM[i] != byte(i+1) {
+			t.Fatalf("after byte %d: OAM[%d] is 0x%02x, want 0x%02x", i, i, cs.LCD.OAM[i], i+1)
+		}
+		if i < 0x9f && cs.LCD.OAM[i+1] != 0 {
+			t.Fatalf("after byte %d: OAM[%d] copied early", i, i+1)
+		}
+	}
+	if cs.OAMDMAActive || cs.OAMDMAPending {
+		t.Errorf("DMA still running after 161 M-cycles")
+	}
+}
+
+func TestOAMDMARestart(t *testing.T) {
+	cs := newOAMDMATestState(t)
+	cs.write(0xff46, 0xc0)
+	runMCycles(cs, 1+50)
+	cs.write(0xff46, 0xd0)
+
+	// the old transfer keeps going through the new one's startup delay
+	runMCycles(cs, 1)
+	if !cs.OAMDMAActive || cs.LCD.OAM[50] != 51 {
+		t.Fatalf("old DMA didn't run through the restart delay: OAM[50] is 0x%02x", cs.LCD.OAM[50])
+	}
+	runMCycles(cs, 1)
+	if cs.LCD.OAM[0] != 0xff || cs.LCD.OAM[1] != 2 {
+		t.Fatalf("restart didn't start over from byte 0: OAM[0:2] is % x", cs.LCD.OAM[:2])
+	}
+	runMCycles(cs, 0x9f)
+	if cs.OAMDMAActive {
+		t.Errorf("restarted DMA didn't finish on time")
+	}
+	for i := 0; i < 0xa0; i++ {
+		if cs.LCD.OAM[i] != byte(0xff-i) {
+			t.Fatalf("OAM[%d] is 0x%02x after restart, want 0x%02x", i, cs.LCD.OAM[i], 0xff-i)
+		}
+	}
+}
+
+func TestOAMDMAEchoRAMSource(t *testing.T) {
+	cs := newOAMDMATestState(t)
+	cs.write(0xff46, 0xf0) // 0xf000 mirrors 0xd000
+	if cs.OAMDMAPendingSource != 0xd000 {
+		t.Fatalf("source is 0x%04x, want 0xd000", cs.OAMDMAPendingSource)
+	}
+	runMCycles(cs, 1+0xa0)
+	for i := 0; i < 0xa0; i++ {
+		if cs.LCD.OAM[i] != byte(0xff-i) {
+			t.Fatalf("OAM[%d] is 0x%02x, want 0x%02x", i, cs.LCD.OAM[i], 0xff-i)
+		}
+	}
+}
+
+func TestOAMDMABusConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		src        byte
+		conflicted []uint16
+		clear      []uint16
+	}{
+		{"from wram", 0xc0, []uint16{0x0150, 0xa000, 0xc000, 0xd100}, []uint16{0x8000, 0x9fff, 0xff80, 0xff47}},
+		{"from vram", 0x80, []uint16{0x8000, 0x9fff}, []uint16{0x0150, 0xc000, 0xff80}},
+	} {
+		cs := newOAMDMATestState(t)
+		cs.write(0xff80, 0x42)
+		cs.write(0xff46, tc.src)
+		runMCycles(cs, 1+10)
+		if !cs.OAMDMAActive {
+			t.Fatalf("%s: DMA not running", tc.name)
+		}
+		for _, addr := range tc.conflicted {
+			if got := cs.busRead(addr); got != cs.OAMDMABusByte {
+				t.Errorf("%s: read of 0x%04x got 0x%02x, want the DMA's byte 0x%02x", tc.name, addr, got, cs.OAMDMABusByte)
+			}
+		}
+		for _, addr := range tc.clear {
+			if got, want := cs.busRead(addr), cs.readNoHooks(addr); got != want {
+				t.Errorf("%s: read of 0x%04x got 0x%02x, want 0x%02x", tc.name, addr, got, want)
+			}
+		}
+		if got := cs.busRead(0xfe00); got != 0xff {
+			t.Errorf("%s: OAM read during DMA got 0x%02x, want 0xff", tc.name, got)
+		}
+	}
+}
+
+func TestOAMDMADoesNotFireHooks(t *testing.T) {
+	cs := newOAMDMATestState(t)
+	cs.AddReadHook(0xc000, 0xc0ff, func(addr uint16, val byte) {
+		t.Fatalf("read hook fired for DMA read of 0x%04x", addr)
+	})
+	cs.write(0xff46, 0xc0)
+	runMCycles(cs, 1+0xa0)
+	if cs.LCD.OAM[0x9f] != 0xa0 {
+		t.Errorf("DMA didn't finish")
+	}
+}
+
+// newVRAMDMATestState is a CGB state with 0x40 bytes of pattern at
+// 0xc000 and the DMA registers pointed from there to 0x9000,
+// which the boot logo leaves clear
+func newVRAMDMATestState(t *testing.T) *cpuState {
+	t.Helper()
+	cs, err := newState(cgbTestROM(0x18, 0xfe), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cs.CGBMode {
+		t.Fatal("test rom didn't run in CGB mode")
+	}
+	for i := uint16(0); i < 0x40; i++ {
+		cs.write(0xc000+i, byte(i+1))
+	}
+	cs.write(0xff51, 0xc0)
+	cs.write(0xff52, 0x00)
+	cs.write(0xff53, 0x10)
+	cs.write(0xff54, 0x00)
+	return cs
+}
+
+func TestGeneralDMAStall(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fastMode bool
+		want     uint
+	}{
+		// 2 blocks of 0x10 bytes, each 32 dots in either speed
+		{"normal speed", false, 2 * 32},
+		{"double speed", true, 2 * 64},
+	} {
+		cs := newVRAMDMATestState(t)
+		cs.FastMode = tc.fastMode
+		cs.AddReadHook(0xc000, 0xc0ff, func(addr uint16, val byte) {
+			t.Fatalf("%s: read hook fired for DMA read of 0x%04x", tc.name, addr)
+		})
+		cs.AddWriteHook(0x9000, 0x90ff, func(addr uint16, val byte) {
+			t.Fatalf("%s: write hook fired for DMA write of 0x%04x", tc.name, addr)
+		})
+		start := cs.Cycles
+		cs.write(0xff55, 0x01)
+		if got := cs.Cycles - start; got != tc.want {
+			t.Errorf("%s: general DMA of 0x20 bytes stalled %d cycles, want %d", tc.name, got, tc.want)
+		}
+		if got := cs.read(0xff55); got != 0xff {
+			t.Errorf("%s: 0xff55 reads 0x%02x after general DMA, want 0xff", tc.name, got)
+		}
+		for i := 0; i < 0x20; i++ {
+			if cs.LCD.VideoRAM[0x1000+i] != byte(i+1) {
+				t.Fatalf("%s: 0x%04x is 0x%02x, want 0x%02x", tc.name, 0x9000+i, cs.LCD.VideoRAM[0x1000+i], i+1)
+			}
+		}
+	}
+}
+
+// runs until the next hblank DMA block is pending
+func runToHblankDMA(t *testing.T, cs *cpuState) {
+	t.Helper()
+	for i := 0; !cs.Mem.DMAHblankPending; i++ {
+		if i > 2*456*154 {
+			t.Fatal("hblank DMA never came due")
+		}
+		cs.runCycles(1)
+	}
+}
+
+func TestHblankDMA(t *testing.T) {
+	cs := newVRAMDMATestState(t)
+	for cs.LCD.InHBlank {
+		cs.runCycles(1)
+	}
+	cs.write(0xff55, 0x82) // 3 blocks
+	if got := cs.read(0xff55); got != 0x02 {
+		t.Errorf("0xff55 reads 0x%02x after starting, want 0x02", got)
+	}
+	if cs.Mem.DMAHblankPending {
+		t.Fatal("hblank DMA came due outside hblank")
+	}
+
+	runToHblankDMA(t, cs)
+	if !cs.LCD.InHBlank {
+		t.Error("hblank DMA came due outside hblank")
+	}
+	start := cs.Cycles
+	cs.runHblankDMA()
+	if got := cs.Cycles - start; got != 32 {
+		t.Errorf("hblank DMA block stalled %d cycles, want 32", got)
+	}
+	if got := cs.read(0xff55); got != 0x01 {
+		t.Errorf("0xff55 reads 0x%02x after one block, want 0x01", got)
+	}
+	if cs.LCD.VideoRAM[0x100f] != 0x10 || cs.LCD.VideoRAM[0x1010] != 0 {
+		t.Errorf("first block didn't copy exactly 0x10 bytes")
+	}
+
+	// halted through a whole hblank, the block is missed
+	cs.InHaltMode = true
+	cs.write(0xffff, 0)
+	runToHblankDMA(t, cs)
+	line := cs.LCD.LYReg
+	for cs.LCD.LYReg == line {
+		cs.step()
+	}
+	if cs.Mem.DMAHblankPending || cs.read(0xff55) != 0x01 {
+		t.Errorf("hblank DMA ran while halted, 0xff55 reads 0x%02x", cs.read(0xff55))
+	}
+	cs.InHaltMode = false
+
+	// cancelled, the remaining length is still readable
+	runToHblankDMA(t, cs)
+	cs.runHblankDMA()
+	cs.write(0xff55, 0x00)
+	if got := cs.read(0xff55); got != 0x80 {
+		t.Errorf("0xff55 reads 0x%02x after cancel, want 0x80", got)
+	}
+	for i := 0; i < 456*2; i++ {
+		cs.runCycles(1)
+		if cs.Mem.DMAHblankPending {
+			t.Fatal("hblank DMA still coming due after cancel")
+		}
+	}
+	if cs.LCD.VideoRAM[0x101f] != 0x20 || cs.LCD.VideoRAM[0x1020] != 0 {
+		t.Errorf("cancelled DMA copied the wrong amount")
+	}
+}
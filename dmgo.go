@@ -2,6 +2,7 @@ package dmgo
 
 import (
 	"fmt"
+	"image"
 )
 
 type cpuState struct {
@@ -21,9 +22,13 @@ type cpuState struct {
 	InHaltMode bool
 	InStopMode bool
 
-	OAMDMAActive bool
-	OAMDMAIndex  uint16
-	OAMDMASource uint16
+	OAMDMAActive        bool
+	OAMDMAIndex         uint16
+	OAMDMASource        uint16
+	OAMDMABusByte       byte
+	OAMDMAPending       bool
+	OAMDMAPendingSource uint16
+	OAMDMAStartDelay    byte
 
 	CGBMode            bool
 	FastMode           bool
@@ -67,13 +72,43 @@ type cpuState struct {
 	Steps  uint
 	Cycles uint
 
+	// set on a real hardware-style hang, e.g. illegal opcodes
+	InLockup bool
+
 	devMode  bool
 	debugger debugger
+	hooks    *hookRegistry
+	// not in hookRegistry so ids keep counting up when it's dropped
+	nextHookID HookID
+
+	// set when emulation hits something it can't continue from
+	faultErr              error
+	lockupOnIllegalOpcode bool
 }
 
 func (cs *cpuState) SetDevMode(b bool) { cs.devMode = b }
 func (cs *cpuState) InDevMode() bool   { return cs.devMode }
 
+func (cs *cpuState) SetDMGPalette(pal DMGPalette)          { cs.LCD.dmgPalette = pal }
+func (cs *cpuState) SetColorCorrection(cc ColorCorrection) { cs.LCD.colorCorrection = cc }
+func (cs *cpuState) SetLCDResponse(resp LCDResponse) {
+	cs.LCD.ghosting.setResponse(resp, cs.LCD.framebuffer[:])
+}
+func (cs *cpuState) SetLayerVisible(layer RenderLayer, visible bool) {
+	cs.LCD.layerToggles.setLayerVisible(layer, visible)
+}
+func (cs *cpuState) SetSpriteVisible(oamIndex int, visible bool) {
+	cs.LCD.layerToggles.setSpriteVisible(oamIndex, visible)
+}
+func (cs *cpuState) SetSpriteLimit(enabled bool) { cs.LCD.noSpriteLimit = !enabled }
+
+// Err returns the error that stopped emulation, if any
+func (cs *cpuState) Err() error { return cs.faultErr }
+
+// SetLockupOnIllegalOpcode makes illegal opcodes hang the cpu, as
+// on real hardware, instead of stopping emulation with an error.
+func (cs *cpuState) SetLockupOnIllegalOpcode(b bool) { cs.lockupOnIllegalOpcode = b }
+
 func (cs *cpuState) runSerialCycle() {
 	if !cs.SerialTransferStartFlag {
 		cs.SerialBitsTransferred = 0
@@ -265,22 +300,48 @@ func (cs *cpuState) readInterruptFlagReg() byte {
 	)
 }
 
-func newState(cart []byte, devMode bool) *cpuState {
-	cartInfo := ParseCartInfo(cart)
+func newState(cart []byte, devMode bool) (*cpuState, error) {
+	cartInfo, err := ParseCartInfo(cart)
+	if err != nil {
+		return nil, err
+	}
+	// pad out to whole banks so the mbcs never index past the end,
+	// in a new slice so the caller's is never written to
+	paddedSize := len(cart)
+	if paddedSize < 0x8000 {
+		paddedSize = 0x8000
+	} else if paddedSize%0x4000 != 0 {
+		paddedSize += 0x4000 - paddedSize%0x4000
+	}
+	if paddedSize != len(cart) {
+		padded := make([]byte, paddedSize)
+		copy(padded, cart)
+		cart = padded
+	}
+
+	ramSize, err := cartInfo.GetRAMSize()
+	if err != nil {
+		return nil, err
+	}
+	mbc, err := makeMBC(cartInfo)
+	if err != nil {
+		return nil, err
+	}
 	state := cpuState{
 		Title:          cartInfo.Title,
 		HeaderChecksum: cartInfo.HeaderChecksum,
 		Mem: mem{
 			cart:                  cart,
-			CartRAM:               make([]byte, cartInfo.GetRAMSize()),
+			CartRAM:               make([]byte, ramSize),
 			InternalRAMBankNumber: 1,
-			mbc:                   makeMBC(cartInfo),
+			mbc:                   mbc,
 		},
+		LCD:     lcd{dmgPalette: DefaultDMGPalette, colorCorrection: DefaultColorCorrection},
 		CGBMode: cartInfo.cgbOptional() || cartInfo.cgbOnly(),
 		devMode: devMode,
 	}
 	state.init()
-	return &state
+	return &state, nil
 }
 
 func (cs *cpuState) init() {
@@ -371,24 +432,60 @@ func (cs *cpuState) initVRAM() {
 	}
 }
 
-func (cs *cpuState) runOAMDMACycle() {
-	i := cs.OAMDMAIndex
-	addr := cs.OAMDMASource
-	cs.write(0xfe00+i, cs.read(addr+i))
-	cs.OAMDMAIndex++
-	if cs.OAMDMAIndex == 0xa0 {
-		cs.OAMDMAActive = false
+func (cs *cpuState) writeOAMDMAReg(val byte) {
+	// a write mid-transfer restarts it, but the old
+	// transfer keeps going until the new one starts
+	cs.OAMDMAPending = true
+	cs.OAMDMAStartDelay = 1
+	cs.OAMDMAPendingSource = uint16(val) << 8
+	if cs.OAMDMAPendingSource >= 0xe000 {
+		cs.OAMDMAPendingSource -= 0x2000 // mirrors wram
 	}
 }
 
+// one byte per M-cycle, 160 total, after a 1 M-cycle startup delay
+func (cs *cpuState) runOAMDMAMCycle() {
+	if cs.OAMDMAPending {
+		if cs.OAMDMAStartDelay > 0 {
+			cs.OAMDMAStartDelay--
+		} else {
+			cs.OAMDMAPending = false
+			cs.OAMDMAActive = true
+			cs.OAMDMAIndex = 0
+			cs.OAMDMASource = cs.OAMDMAPendingSource
+		}
+	}
+	if cs.OAMDMAActive {
+		i := cs.OAMDMAIndex
+		cs.OAMDMABusByte = cs.readNoHooks(cs.OAMDMASource + i)
+		cs.LCD.OAM[i] = cs.OAMDMABusByte
+		cs.OAMDMAIndex++
+		if cs.OAMDMAIndex == 0xa0 {
+			cs.OAMDMAActive = false
+		}
+	}
+}
+
+// While OAM DMA runs, the CPU reading anything on the same bus as the
+// DMA source (vram, or cart/wram) gets the byte the DMA is moving.
+// Only HRAM and IO are safe, which is why DMA routines live in HRAM.
+func (cs *cpuState) oamDMABusConflict(addr uint16) bool {
+	if !cs.OAMDMAActive || addr >= 0xfe00 {
+		return false
+	}
+	addrOnVRAMBus := addr >= 0x8000 && addr < 0xa000
+	dmaOnVRAMBus := cs.OAMDMASource >= 0x8000 && cs.OAMDMASource < 0xa000
+	return addrOnVRAMBus == dmaOnVRAMBus
+}
+
 func (cs *cpuState) runCycles(numCycles uint) {
 	// Things that speed up to match fast mode
 	for i := uint(0); i < numCycles; i++ {
 		cs.Cycles++
 		cs.runTimerCycle()
 		cs.runSerialCycle()
-		if cs.OAMDMAActive {
-			cs.runOAMDMACycle()
+		if cs.Cycles&3 == 0 && (cs.OAMDMAActive || cs.OAMDMAPending) {
+			cs.runOAMDMAMCycle()
 		}
 	}
 	if cs.FastMode {
@@ -430,12 +527,66 @@ type Emulator interface {
 	ReadSoundBuffer([]byte) []byte
 	GetSoundBufferInfo() SoundBufferInfo
 
+	// StartSoundRecording, StopSoundRecording, and IsRecordingSound
+	// record the sound straight from the APU to a wav
+	StartSoundRecording(filename string) error
+	StopSoundRecording() error
+	IsRecordingSound() bool
+	// SetSoundRecorder feeds a Recorder its sound straight from the APU
+	SetSoundRecorder(rec Recorder) error
+
 	GetCartRAM() []byte
 	SetCartRAM([]byte) error
 
+	Registers() Registers
+	SetRegisters(Registers)
+
+	AddExecHook(pc uint16, bank int, fn func(pc uint16)) HookID
+	AddReadHook(start, end uint16, fn func(addr uint16, val byte)) HookID
+	AddWriteHook(start, end uint16, fn func(addr uint16, val byte)) HookID
+	RemoveHook(id HookID)
+
 	MakeSnapshot() []byte
 	LoadSnapshot([]byte) (Emulator, error)
 
+	Err() error
+	SetLockupOnIllegalOpcode(b bool)
+
+	// SetDMGPalette sets the colors used for DMG games (CGB games
+	// use their own palettes and ignore it)
+	SetDMGPalette(pal DMGPalette)
+	// SetColorCorrection sets how CGB games' colors are adapted for
+	// modern screens (DMG games use their palette colors as-is)
+	SetColorCorrection(cc ColorCorrection)
+	// SetLCDResponse turns on (or off, with the zero value)
+	// LCD ghosting for the frames returned by Framebuffer
+	SetLCDResponse(resp LCDResponse)
+
+	// SetLayerVisible and SetSpriteVisible hide layers or single
+	// sprites (by OAM index) from the screen, ignoring LCDC, for
+	// debugging and ripping graphics. Emulation is unaffected.
+	SetLayerVisible(layer RenderLayer, visible bool)
+	SetSpriteVisible(oamIndex int, visible bool)
+
+	// SetSpriteLimit turns the 10-sprites-per-line limit on (the default)
+	// or off. With it off, games that flicker to work around the limit
+	// show everything, though emulation timing still acts as if it's on.
+	SetSpriteLimit(enabled bool)
+
+	// TilesImage and TileMapImage draw VRAM for debugging, see viewers.go
+	TilesImage(pal ViewerPalette) *image.RGBA
+	TileMapImage(tm TileMap, overlay bool) *image.RGBA
+
+	// InspectOAM and SpriteSheetImage show what's in OAM, see oamview.go
+	InspectOAM() []SpriteInfo
+	SpriteSheetImage() *image.RGBA
+
+	// Palettes, SetPaletteColor, and PalettesImage view and edit
+	// palettes live, see palview.go
+	Palettes() []PaletteSwatch
+	SetPaletteColor(vp ViewerPalette, colorIndex int, value uint16) error
+	PalettesImage() *image.RGBA
+
 	InDevMode() bool
 	SetDevMode(b bool)
 	UpdateDbgKeyState([]bool)
@@ -454,9 +605,14 @@ func (cs *cpuState) LoadSnapshot(snapBytes []byte) (Emulator, error) {
 	return cs.loadSnapshot(snapBytes)
 }
 
-// NewEmulator creates an emulation session
-func NewEmulator(cart []byte, devMode bool) Emulator {
-	return newState(cart, devMode)
+// NewEmulator creates an emulation session, returning an
+// error if the cart header is bad or the mapper unsupported
+func NewEmulator(cart []byte, devMode bool) (Emulator, error) {
+	cs, err := newState(cart, devMode)
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
 }
 
 // Input covers all outside info sent to the Emulator
@@ -486,6 +642,34 @@ func (cs *cpuState) GetSoundBufferInfo() SoundBufferInfo {
 	}
 }
 
+// StartSoundRecording writes everything the APU plays from now on to
+// a 16-bit stereo 44.1kHz wav, sample for sample, until
+// StopSoundRecording. The APU only runs ahead of ReadSoundBuffer by so
+// much, so keep reading sound while recording.
+func (cs *cpuState) StartSoundRecording(filename string) error {
+	return cs.APU.startRecording(filename)
+}
+
+// StopSoundRecording finishes the wav from StartSoundRecording,
+// returning any error hit while writing it
+func (cs *cpuState) StopSoundRecording() error {
+	return cs.APU.stopRecording()
+}
+
+// IsRecordingSound is true between StartSoundRecording and StopSoundRecording
+func (cs *cpuState) IsRecordingSound() bool {
+	return cs.APU.wavOut != nil
+}
+
+// SetSoundRecorder hands every sample the APU makes to rec.WriteAudio,
+// the same way StartSoundRecording does, so the sound matches the
+// emulated time of the frames rather than how playback went. As with
+// StartSoundRecording, keep reading sound while recording. nil stops
+// it. Returns the first error the previous recorder's WriteAudio hit.
+func (cs *cpuState) SetSoundRecorder(rec Recorder) error {
+	return cs.APU.setRecorder(rec)
+}
+
 // GetCartRAM returns the current state of external RAM
 func (cs *cpuState) GetCartRAM() []byte {
 	return append([]byte{}, cs.Mem.CartRAM...)
@@ -505,9 +689,10 @@ func (cs *cpuState) UpdateInput(input Input) {
 	cs.updateJoypad(input.Joypad)
 }
 
-// Framebuffer returns the current state of the lcd screen
+// Framebuffer returns the current state of the lcd screen,
+// with ghosting applied if an LCDResponse is set
 func (cs *cpuState) Framebuffer() []byte {
-	return cs.LCD.framebuffer[:]
+	return cs.LCD.displayedFramebuffer()
 }
 
 // FlipRequested indicates if a draw request is pending
@@ -518,26 +703,47 @@ func (cs *cpuState) FlipRequested() bool {
 	return val
 }
 
-var lastSP = int(-1)
-
 func (cs *cpuState) debugLineOnStackChange() {
-	if lastSP != int(cs.SP) {
-		lastSP = int(cs.SP)
+	d := &cs.debugger
+	if !d.lastSPValid || d.lastSP != cs.SP {
+		d.lastSP, d.lastSPValid = cs.SP, true
 		fmt.Println(cs.DebugStatusLine())
 	}
 }
 
-// Step steps the emulator one instruction
+// Step steps the emulator one instruction. Does nothing
+// once emulation has been stopped by an error, see Err().
 func (cs *cpuState) Step() {
+	if cs.faultErr != nil {
+		return
+	}
 	cs.step()
 }
 func (cs *cpuState) DbgStep() {
 	cs.debugger.step(cs)
 }
 
-var hitTarget = false
-
 func (cs *cpuState) step() {
+	cs.runStep()
+
+	// out here so it's picked up however runStep returns
+	if cs.Mem.faultErr != nil {
+		cs.stepErr(cs.Mem.faultErr.Error())
+		cs.Mem.faultErr = nil
+	}
+}
+
+func (cs *cpuState) runStep() {
+	if cs.InLockup {
+		// cpu's hung, but the rest of the hardware keeps going
+		cs.runCycles(4)
+		return
+	}
+
+	if cs.Mem.DMAHblankPending && !cs.InHaltMode {
+		cs.runHblankDMA()
+	}
+
 	ieAndIfFlagMatch := cs.handleInterrupts()
 	if cs.InHaltMode {
 		if ieAndIfFlagMatch {
@@ -552,9 +758,9 @@ func (cs *cpuState) step() {
 	// cs.debugLineOnStackChange()
 	// if cs.Steps&0x2ffff == 0 {
 	// if cs.PC == 0x4d19 {
-	// 	hitTarget = true
+	// 	cs.debugger.hitTarget = true
 	// }
-	// if hitTarget {
+	// if cs.debugger.hitTarget {
 	// 	fmt.Println(cs.DebugStatusLine())
 	// }
 	// fmt.Fprintln(os.Stderr, cs.DebugStatusLine())
@@ -579,8 +785,3 @@ func (cs *cpuState) step() {
 
 	cs.stepOpcode()
 }
-
-func fatalErr(v ...interface{}) {
-	fmt.Println(v...)
-	panic("fatalErr()")
-}
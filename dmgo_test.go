@@ -0,0 +1,102 @@
+package dmgo
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestNewEmulatorDoesNotWriteCallersROM(t *testing.T) {
+	// a short rom with spare capacity after it, that padding
+	// out to 32KB with append would have written zeros into
+	backing := make([]byte, 0x8000)
+	for i := range backing {
+		backing[i] = 0xaa
+	}
+	copy(backing, loopROM()[:0x4000])
+	rom := backing[:0x4000]
+	if _, err := NewEmulator(rom, false); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range backing[0x4000:] {
+		if b != 0xaa {
+			t.Fatalf("byte 0x%04x past the rom changed to 0x%02x", 0x4000+i, b)
+		}
+	}
+}
+
+func TestMemFaultPickedUpWhileStalled(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		stall func(cs *cpuState)
+	}{
+		{"lockup", func(cs *cpuState) { cs.InLockup = true }},
+		{"halt", func(cs *cpuState) {
+			cs.InHaltMode = true
+			cs.writeInterruptEnableReg(0)
+		}},
+	} {
+		emu, err := NewEmulator(loopROM(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := emu.(*cpuState)
+		tc.stall(cs)
+		cs.Mem.fault("test fault")
+		emu.Step()
+		if emu.Err() == nil {
+			t.Errorf("%s: fault not reported after the step it happened in", tc.name)
+		}
+	}
+}
+
+// run with -race: sessions must not share any state
+func TestConcurrentSessions(t *testing.T) {
+	// fills VRAM, so the lcd has something to draw
+	rom := testROM(
+		0x21, 0x00, 0x80, // ld hl,0x8000
+		0x7d,       // ld a,l
+		0x22,       // ld (hl+),a
+		0x7c,       // ld a,h
+		0xfe, 0x98, // cp 0x98
+		0x20, 0xf9, // jr nz,-7
+		0x18, 0xfe, // jr -2
+	)
+	const sessions = 4
+	// the race detector can miss races between goroutines that
+	// never actually run at the same time
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(sessions))
+	var wg sync.WaitGroup
+	framebuffers := make([][]byte, sessions)
+	for i := 0; i < sessions; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			emu, err := NewEmulator(rom, false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			emu.SetLCDResponse(LCDResponsePresets["dmg"])
+			buf := make([]byte, 1024)
+			for n := 0; n < 10; {
+				emu.Step()
+				if emu.GetSoundBufferInfo().UsedSize >= len(buf) {
+					emu.ReadSoundBuffer(buf)
+				}
+				if emu.FlipRequested() {
+					n++
+				}
+			}
+			emu.TilesImage(ViewerPalette{})
+			framebuffers[i] = append([]byte{}, emu.Framebuffer()...)
+		}()
+	}
+	wg.Wait()
+	for i := 1; i < sessions; i++ {
+		if string(framebuffers[i]) != string(framebuffers[0]) {
+			t.Errorf("session %d drew a different frame than session 0", i)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package dmgo
 
 import (
 	"fmt"
+	"image"
 	"os"
 )
 
@@ -28,14 +29,27 @@ func (e *errEmu) GetCartRAM() []byte { return []byte{} }
 func (e *errEmu) SetCartRAM([]byte) error {
 	return fmt.Errorf("save not implemented for errEmu")
 }
-func (e *errEmu) MakeSnapshot() []byte { return nil }
+func (e *errEmu) Registers() Registers   { return Registers{} }
+func (e *errEmu) SetRegisters(Registers) {}
+
+func (e *errEmu) AddExecHook(uint16, int, func(uint16)) HookID           { return 0 }
+func (e *errEmu) AddReadHook(uint16, uint16, func(uint16, byte)) HookID  { return 0 }
+func (e *errEmu) AddWriteHook(uint16, uint16, func(uint16, byte)) HookID { return 0 }
+func (e *errEmu) RemoveHook(HookID)                                      {}
+func (e *errEmu) MakeSnapshot() []byte                                   { return nil }
 func (e *errEmu) LoadSnapshot([]byte) (Emulator, error) {
 	return nil, fmt.Errorf("snapshots not implemented for errEmu")
 }
 func (e *errEmu) ReadSoundBuffer(toFill []byte) []byte { return nil }
 func (e *errEmu) GetSoundBufferInfo() SoundBufferInfo  { return SoundBufferInfo{} }
-func (e *errEmu) UpdateInput(input Input)              {}
-func (e *errEmu) Step()                                {}
+func (e *errEmu) StartSoundRecording(filename string) error {
+	return fmt.Errorf("no sound to record")
+}
+func (e *errEmu) StopSoundRecording() error           { return fmt.Errorf("not recording sound") }
+func (e *errEmu) IsRecordingSound() bool              { return false }
+func (e *errEmu) SetSoundRecorder(rec Recorder) error { return nil }
+func (e *errEmu) UpdateInput(input Input)             {}
+func (e *errEmu) Step()                               {}
 
 func (e *errEmu) Framebuffer() []byte { return e.screen[:] }
 func (e *errEmu) FlipRequested() bool {
@@ -44,6 +58,27 @@ func (e *errEmu) FlipRequested() bool {
 	return result
 }
 
+func (e *errEmu) Err() error                                      { return nil }
+func (e *errEmu) SetLockupOnIllegalOpcode(b bool)                 {}
+func (e *errEmu) SetDMGPalette(pal DMGPalette)                    {}
+func (e *errEmu) SetColorCorrection(cc ColorCorrection)           {}
+func (e *errEmu) SetLCDResponse(resp LCDResponse)                 {}
+func (e *errEmu) SetLayerVisible(layer RenderLayer, visible bool) {}
+func (e *errEmu) SetSpriteVisible(oamIndex int, visible bool)     {}
+func (e *errEmu) SetSpriteLimit(enabled bool)                     {}
+
+func (e *errEmu) TilesImage(pal ViewerPalette) *image.RGBA { return image.NewRGBA(image.Rectangle{}) }
+func (e *errEmu) TileMapImage(tm TileMap, overlay bool) *image.RGBA {
+	return image.NewRGBA(image.Rectangle{})
+}
+func (e *errEmu) InspectOAM() []SpriteInfo      { return nil }
+func (e *errEmu) SpriteSheetImage() *image.RGBA { return image.NewRGBA(image.Rectangle{}) }
+func (e *errEmu) Palettes() []PaletteSwatch     { return nil }
+func (e *errEmu) SetPaletteColor(vp ViewerPalette, colorIndex int, value uint16) error {
+	return nil
+}
+func (e *errEmu) PalettesImage() *image.RGBA { return image.NewRGBA(image.Rectangle{}) }
+
 func (e *errEmu) SetDevMode(b bool)          { e.devMode = b }
 func (e *errEmu) InDevMode() bool            { return e.devMode }
 func (e *errEmu) UpdateDbgKeyState(b []bool) {}
@@ -18,6 +18,9 @@ type gbsPlayer struct {
 	TextDisplay      textDisplay
 	DbgScreen        [160 * 144 * 4]byte
 
+	lastInput        time.Time
+	lastScreenUpdate time.Time
+
 	devMode bool
 }
 
@@ -114,6 +117,9 @@ func NewGbsPlayer(gbs []byte, devMode bool) Emulator {
 	gp.patchRsts()
 
 	gp.initTune(gp.Hdr.StartSong - 1)
+	if gp.faultErr != nil {
+		return NewErrEmu(fmt.Sprintf("gbs player error\n%s", gp.faultErr.Error()))
+	}
 
 	gp.updateScreen()
 
@@ -167,7 +173,7 @@ func (gp *gbsPlayer) initTune(songNum byte) {
 	gp.SP = gp.Hdr.StackPtr
 	gp.pushOp16(0x0130)
 	gp.PC = gp.Hdr.InitAddr
-	for gp.PC != 0x0130 {
+	for gp.PC != 0x0130 && gp.faultErr == nil {
 		gp.Step()
 	}
 
@@ -235,37 +241,33 @@ func (gp *gbsPlayer) togglePause() {
 	gp.updateScreen()
 }
 
-var lastInput time.Time
-
 func (gp *gbsPlayer) UpdateInput(input Input) {
 	now := time.Now()
-	if now.Sub(lastInput).Seconds() > 0.20 {
+	if now.Sub(gp.lastInput).Seconds() > 0.20 {
 		if input.Joypad.Left {
 			gp.prevSong()
-			lastInput = now
+			gp.lastInput = now
 		}
 		if input.Joypad.Right {
 			gp.nextSong()
-			lastInput = now
+			gp.lastInput = now
 		}
 		if input.Joypad.Start {
 			gp.togglePause()
-			lastInput = now
+			gp.lastInput = now
 		}
 	}
 }
 
-var lastScreenUpdate time.Time
-
 func (gp *gbsPlayer) DbgStep() {
 	gp.cpuState.debugger.step(gp)
 }
 func (gp *gbsPlayer) Step() {
-	if !gp.Paused {
+	if !gp.Paused && gp.faultErr == nil {
 
 		now := time.Now()
-		if now.Sub(lastScreenUpdate) >= 100*time.Millisecond {
-			lastScreenUpdate = now
+		if now.Sub(gp.lastScreenUpdate) >= 100*time.Millisecond {
+			gp.lastScreenUpdate = now
 			gp.updateScreen()
 		}
 
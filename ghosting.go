@@ -0,0 +1,101 @@
+package dmgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LCDResponse models how slowly LCD pixels change, which games that
+// flicker sprites every other frame rely on to look transparent. Each
+// frame, a pixel only moves part of the way toward its new color,
+// keeping Darkening (when getting darker) or Lightening (when getting
+// lighter) of the distance it had left to go. Both zero means no
+// ghosting, and Framebuffer returns frames exactly as drawn.
+type LCDResponse struct {
+	Darkening  float32
+	Lightening float32
+}
+
+// LCDResponsePresets are the built-in LCD responses, by name
+var LCDResponsePresets = map[string]LCDResponse{
+	"off": {},
+	// plain 50/50 mix of each frame with the last
+	"blend": {Darkening: 0.5, Lightening: 0.5},
+	// the original's slow, smeary screen
+	"dmg": {Darkening: 0.55, Lightening: 0.65},
+	// a faster screen, but still plenty of ghosting
+	"pocket": {Darkening: 0.4, Lightening: 0.5},
+	// fast enough that only flicker really shows
+	"cgb": {Darkening: 0.2, Lightening: 0.3},
+}
+
+// LCDResponsePresetNames lists the preset names, sorted
+func LCDResponsePresetNames() []string {
+	names := []string{}
+	for name := range LCDResponsePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetLCDResponsePreset looks up a preset by name (case-insensitive)
+func GetLCDResponsePreset(name string) (LCDResponse, error) {
+	if resp, ok := LCDResponsePresets[strings.ToLower(name)]; ok {
+		return resp, nil
+	}
+	return LCDResponse{}, fmt.Errorf("unknown lcd response %q, choices are: %s", name, strings.Join(LCDResponsePresetNames(), ", "))
+}
+
+func (r LCDResponse) enabled() bool { return r.Darkening > 0 || r.Lightening > 0 }
+
+type lcdGhosting struct {
+	response LCDResponse
+
+	// what the lcd is actually showing, in float so slow fades don't get stuck
+	shown      [160 * 144 * 3]float32
+	shownValid bool
+
+	framebuffer [160 * 144 * 4]byte
+}
+
+// frame is the lcd's current framebuffer, shown as-is until the
+// next one finishes so the ghosted framebuffer is never blank
+func (g *lcdGhosting) setResponse(r LCDResponse, frame []byte) {
+	g.response = r
+	g.shownValid = false
+	g.blendFrame(frame)
+}
+
+// called once per finished frame
+func (g *lcdGhosting) blendFrame(frame []byte) {
+	if !g.response.enabled() {
+		return
+	}
+	if !g.shownValid {
+		for i, j := 0, 0; i < len(frame); i, j = i+4, j+3 {
+			g.shown[j+0] = float32(frame[i+0])
+			g.shown[j+1] = float32(frame[i+1])
+			g.shown[j+2] = float32(frame[i+2])
+		}
+		g.shownValid = true
+	} else {
+		for i, j := 0, 0; i < len(frame); i, j = i+4, j+3 {
+			for c := 0; c < 3; c++ {
+				target, shown := float32(frame[i+c]), g.shown[j+c]
+				keep := g.response.Lightening
+				if target < shown {
+					keep = g.response.Darkening
+				}
+				g.shown[j+c] = target + (shown-target)*keep
+			}
+		}
+	}
+	for i, j := 0, 0; i < len(g.framebuffer); i, j = i+4, j+3 {
+		g.framebuffer[i+0] = byte(g.shown[j+0] + 0.5)
+		g.framebuffer[i+1] = byte(g.shown[j+1] + 0.5)
+		g.framebuffer[i+2] = byte(g.shown[j+2] + 0.5)
+		g.framebuffer[i+3] = 0xff
+	}
+}
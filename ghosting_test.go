@@ -0,0 +1,60 @@
+package dmgo
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLCDResponseStartsFromCurrentFrame(t *testing.T) {
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 2)
+	frame := append([]byte{}, emu.Framebuffer()...)
+
+	emu.SetLCDResponse(LCDResponsePresets["dmg"])
+	if !bytes.Equal(emu.Framebuffer(), frame) {
+		t.Errorf("framebuffer changed when ghosting was turned on")
+	}
+	runFrames(emu, 1)
+	if !bytes.Equal(emu.Framebuffer(), frame) {
+		t.Errorf("ghosting an unchanging screen changed it")
+	}
+}
+
+// each preset fades a pixel from white to black and back at its own rate
+func TestLCDResponseBlending(t *testing.T) {
+	for _, name := range LCDResponsePresetNames() {
+		resp := LCDResponsePresets[name]
+		emu, err := NewEmulator(loopROM(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runFrames(emu, 2)
+		emu.SetLCDResponse(resp)
+		cs := emu.(*cpuState)
+
+		// in vblank, so each frame after a BGP write is all new color
+		shown := float32(0xff)
+		for frame := 0; frame < 6; frame++ {
+			target, keep := float32(0x00), resp.Darkening
+			cs.write(0xff47, 0xff) // everything black
+			if frame >= 3 {
+				target, keep = 0xff, resp.Lightening
+				cs.write(0xff47, 0x00) // everything white
+			}
+			runFrames(emu, 1)
+			shown = target + (shown-target)*keep
+			want := byte(shown + 0.5)
+
+			fb := emu.Framebuffer()
+			i := (100*160 + 100) * 4
+			for c := 0; c < 3; c++ {
+				if got := fb[i+c]; int(got) < int(want)-1 || int(got) > int(want)+1 {
+					t.Errorf("%s frame %d: channel %d is 0x%02x, want 0x%02x", name, frame, c, got, want)
+				}
+			}
+		}
+	}
+}
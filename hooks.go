@@ -0,0 +1,154 @@
+package dmgo
+
+// HookID identifies a registered hook so it can be removed later
+type HookID int
+
+// AnyBank matches any bank when passed to AddExecHook
+const AnyBank = -1
+
+type execHook struct {
+	id   HookID
+	pc   uint16
+	bank int
+	fn   func(pc uint16)
+}
+
+type memHook struct {
+	id         HookID
+	start, end uint16 // inclusive
+	fn         func(addr uint16, val byte)
+}
+
+// not marshalled in snapshot, but carried over on load
+type hookRegistry struct {
+	execHooks  []execHook
+	readHooks  []memHook
+	writeHooks []memHook
+
+	// so hooks can peek at mem without re-triggering hooks
+	inHook bool
+}
+
+func (h *hookRegistry) empty() bool {
+	return len(h.execHooks) == 0 && len(h.readHooks) == 0 && len(h.writeHooks) == 0
+}
+
+// the id counter lives on cpuState rather than the registry, which is
+// dropped when empty, so ids are never reused
+func (cs *cpuState) getHooks() (*hookRegistry, HookID) {
+	if cs.hooks == nil {
+		cs.hooks = &hookRegistry{}
+	}
+	cs.nextHookID++
+	return cs.hooks, cs.nextHookID
+}
+
+// AddExecHook calls fn just before the instruction at pc is executed.
+// If bank is not AnyBank, the hook only fires when that bank is
+// mapped at pc (the ROM bank for 0x4000-0x7fff, the RAM banks for
+// 0xa000-0xbfff and 0xd000-0xdfff, and zero elsewhere).
+func (cs *cpuState) AddExecHook(pc uint16, bank int, fn func(pc uint16)) HookID {
+	h, id := cs.getHooks()
+	h.execHooks = append(h.execHooks, execHook{id: id, pc: pc, bank: bank, fn: fn})
+	return id
+}
+
+// AddReadHook calls fn after any read in the range [start, end].
+// That's every read the cpu makes, opcode and operand fetches included,
+// but not the DMA units' reads.
+func (cs *cpuState) AddReadHook(start, end uint16, fn func(addr uint16, val byte)) HookID {
+	h, id := cs.getHooks()
+	h.readHooks = append(h.readHooks, memHook{id: id, start: start, end: end, fn: fn})
+	return id
+}
+
+// AddWriteHook calls fn after any write in the range [start, end],
+// including pushes to the stack, but not the DMA units' writes
+func (cs *cpuState) AddWriteHook(start, end uint16, fn func(addr uint16, val byte)) HookID {
+	h, id := cs.getHooks()
+	h.writeHooks = append(h.writeHooks, memHook{id: id, start: start, end: end, fn: fn})
+	return id
+}
+
+// RemoveHook unregisters a hook. Unknown ids are ignored.
+func (cs *cpuState) RemoveHook(id HookID) {
+	if cs.hooks == nil {
+		return
+	}
+	h := cs.hooks
+	h.execHooks = removeExecHook(h.execHooks, id)
+	h.readHooks = removeMemHook(h.readHooks, id)
+	h.writeHooks = removeMemHook(h.writeHooks, id)
+	cs.dropHooksIfEmpty()
+}
+
+func (cs *cpuState) dropHooksIfEmpty() {
+	// keep the fast path fast, but not from inside a hook,
+	// runExecHooks/runMemHooks check again once they're done
+	if cs.hooks != nil && !cs.hooks.inHook && cs.hooks.empty() {
+		cs.hooks = nil
+	}
+}
+
+func removeExecHook(hooks []execHook, id HookID) []execHook {
+	for i := range hooks {
+		if hooks[i].id == id {
+			return append(hooks[:i:i], hooks[i+1:]...)
+		}
+	}
+	return hooks
+}
+func removeMemHook(hooks []memHook, id HookID) []memHook {
+	for i := range hooks {
+		if hooks[i].id == id {
+			return append(hooks[:i:i], hooks[i+1:]...)
+		}
+	}
+	return hooks
+}
+
+func (cs *cpuState) bankForAddr(addr uint16) int {
+	switch {
+	case addr >= 0x4000 && addr < 0x8000:
+		return cs.Mem.mbc.GetROMBankNumber()
+	case addr >= 0xa000 && addr < 0xc000:
+		return cs.Mem.mbc.GetRAMBankNumber()
+	case addr >= 0xd000 && addr < 0xe000:
+		return int(cs.Mem.InternalRAMBankNumber)
+	}
+	return 0
+}
+
+// The hook loops run over the slice as it was when they started, so
+// hooks can add or remove hooks (including themselves) safely. The
+// changes take effect from the next run.
+
+func (cs *cpuState) runExecHooks(pc uint16) {
+	h := cs.hooks
+	if h.inHook || len(h.execHooks) == 0 {
+		return
+	}
+	h.inHook = true
+	for _, e := range append([]execHook{}, h.execHooks...) {
+		if e.pc == pc && (e.bank == AnyBank || e.bank == cs.bankForAddr(pc)) {
+			e.fn(pc)
+		}
+	}
+	h.inHook = false
+	cs.dropHooksIfEmpty()
+}
+
+func (cs *cpuState) runMemHooks(hooks []memHook, addr uint16, val byte) {
+	h := cs.hooks
+	if h.inHook {
+		return
+	}
+	h.inHook = true
+	for _, m := range append([]memHook{}, hooks...) {
+		if addr >= m.start && addr <= m.end {
+			m.fn(addr, val)
+		}
+	}
+	h.inHook = false
+	cs.dropHooksIfEmpty()
+}
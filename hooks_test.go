@@ -0,0 +1,147 @@
+package dmgo
+
+import "testing"
+
+// ld a,0x12; ld (0xc000),a; ld a,(0xc000); jr to start
+var hookTestProgram = []byte{0x3e, 0x12, 0xea, 0x00, 0xc0, 0xfa, 0x00, 0xc0, 0x18, 0xf6}
+
+func newHookTestEmu(t *testing.T) Emulator {
+	emu, err := NewEmulator(testROM(hookTestProgram...), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emu
+}
+
+// runs one pass of hookTestProgram, starting from 0x150
+func runHookTestLoop(emu Emulator) {
+	for i := 0; i < 4; i++ {
+		emu.Step()
+	}
+	for emu.Registers().PC != 0x150 {
+		emu.Step()
+	}
+}
+
+func TestHooksFire(t *testing.T) {
+	emu := newHookTestEmu(t)
+	runHookTestLoop(emu) // get to 0x150
+
+	execs, reads, writes := 0, 0, 0
+	emu.AddExecHook(0x150, AnyBank, func(pc uint16) { execs++ })
+	emu.AddExecHook(0x150, 5, func(pc uint16) { t.Error("exec hook fired for the wrong bank") })
+	emu.AddReadHook(0xc000, 0xc000, func(addr uint16, val byte) {
+		reads++
+		if val != 0x12 {
+			t.Errorf("read hook got 0x%02x, want 0x12", val)
+		}
+	})
+	emu.AddWriteHook(0xc000, 0xc0ff, func(addr uint16, val byte) {
+		writes++
+		if addr != 0xc000 || val != 0x12 {
+			t.Errorf("write hook got (0x%04x, 0x%02x), want (0xc000, 0x12)", addr, val)
+		}
+	})
+	for i := 0; i < 3; i++ {
+		runHookTestLoop(emu)
+	}
+	if execs != 3 || reads != 3 || writes != 3 {
+		t.Errorf("got %d execs, %d reads, %d writes, want 3 of each", execs, reads, writes)
+	}
+}
+
+// read hooks see every cpu read, instruction fetches included
+func TestReadHookSeesFetches(t *testing.T) {
+	emu := newHookTestEmu(t)
+	runHookTestLoop(emu)
+
+	fetched := map[uint16]int{}
+	emu.AddReadHook(0x150, 0x150+uint16(len(hookTestProgram))-1, func(addr uint16, val byte) {
+		fetched[addr]++
+		if want := hookTestProgram[addr-0x150]; val != want {
+			t.Errorf("fetch of 0x%04x got 0x%02x, want 0x%02x", addr, val, want)
+		}
+	})
+	runHookTestLoop(emu)
+	for i := range hookTestProgram {
+		if n := fetched[0x150+uint16(i)]; n != 1 {
+			t.Errorf("0x%04x fetched %d times in one pass, want 1", 0x150+i, n)
+		}
+	}
+}
+
+func TestRemoveHook(t *testing.T) {
+	emu := newHookTestEmu(t)
+	runHookTestLoop(emu)
+
+	calls := 0
+	id := emu.AddExecHook(0x150, AnyBank, func(pc uint16) { calls++ })
+	runHookTestLoop(emu)
+	emu.RemoveHook(id)
+	runHookTestLoop(emu)
+	if calls != 1 {
+		t.Errorf("hook called %d times, want 1", calls)
+	}
+
+	// the registry's gone now that it's empty, ids must still not repeat
+	newCalls := 0
+	newID := emu.AddExecHook(0x150, AnyBank, func(pc uint16) { newCalls++ })
+	if newID == id {
+		t.Fatalf("hook id %d reused", id)
+	}
+	emu.RemoveHook(id)
+	runHookTestLoop(emu)
+	if newCalls != 1 {
+		t.Errorf("removing an old id removed a new hook")
+	}
+}
+
+func TestRemoveHookFromCallback(t *testing.T) {
+	emu := newHookTestEmu(t)
+	runHookTestLoop(emu)
+
+	var firstID HookID
+	first, second := 0, 0
+	firstID = emu.AddExecHook(0x150, AnyBank, func(pc uint16) {
+		first++
+		emu.RemoveHook(firstID)
+	})
+	emu.AddExecHook(0x150, AnyBank, func(pc uint16) { second++ })
+	runHookTestLoop(emu)
+	if first != 1 || second != 1 {
+		t.Fatalf("first run: got %d, %d calls, want 1, 1 (the hook after a removed one was skipped)", first, second)
+	}
+	runHookTestLoop(emu)
+	if first != 1 || second != 2 {
+		t.Errorf("second run: got %d, %d calls, want 1, 2", first, second)
+	}
+
+	// removing the last hooks from inside a hook, then adding more
+	var ids []HookID
+	reads := 0
+	for i := 0; i < 2; i++ {
+		ids = append(ids, emu.AddReadHook(0xc000, 0xc000, func(addr uint16, val byte) {
+			reads++
+			for _, id := range ids {
+				emu.RemoveHook(id)
+			}
+		}))
+	}
+	cs := emu.(*cpuState)
+	for _, h := range cs.hooks.execHooks {
+		emu.RemoveHook(h.id)
+	}
+	runHookTestLoop(emu)
+	if reads != 2 {
+		t.Errorf("got %d read hook calls, want 2", reads)
+	}
+	if cs.hooks != nil {
+		t.Errorf("empty hook registry not dropped after hooks ran")
+	}
+	writes := 0
+	emu.AddWriteHook(0xc000, 0xc000, func(addr uint16, val byte) { writes++ })
+	runHookTestLoop(emu)
+	if reads != 2 || writes != 1 {
+		t.Errorf("after re-adding: got %d reads, %d writes, want 2, 1", reads, writes)
+	}
+}
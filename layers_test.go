@@ -0,0 +1,105 @@
+package dmgo
+
+import "testing"
+
+// newLayerTestEmu draws the bg in shade 1, the window (over the bottom
+// right quarter of the screen) in shade 2, and sprites as solid shade 3
+// 8x8 squares at the given screen positions, in oam order
+func newLayerTestEmu(t *testing.T, sprites ...[2]int) Emulator {
+	t.Helper()
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 1)
+	cs := emu.(*cpuState)
+	for i := 0; i < 8; i++ {
+		// tile 0: color 1, tile 2: color 2 (over the boot logo's tiles)
+		cs.LCD.VideoRAM[0x00+i*2], cs.LCD.VideoRAM[0x00+i*2+1] = 0xff, 0x00
+		cs.LCD.VideoRAM[0x20+i*2], cs.LCD.VideoRAM[0x20+i*2+1] = 0x00, 0xff
+	}
+	for i := 0; i < 16; i++ {
+		cs.LCD.VideoRAM[0x7f0+i] = 0xff // tile 0x7f: color 3
+	}
+	for i := 0; i < 0x400; i++ {
+		cs.LCD.VideoRAM[0x1800+i] = 0
+		cs.LCD.VideoRAM[0x1c00+i] = 2
+	}
+	for i := range cs.LCD.OAM {
+		cs.LCD.OAM[i] = 0
+	}
+	for i, pos := range sprites {
+		copy(cs.LCD.OAM[i*4:], []byte{byte(pos[1] + 16), byte(pos[0] + 8), 0x7f, 0})
+	}
+	cs.write(0xff47, 0xe4)
+	cs.write(0xff48, 0xe4)
+	cs.write(0xff4a, 72)
+	cs.write(0xff4b, 80+7)
+	cs.write(0xff40, 0xf3) // bg, window (at 0x9c00), sprites, tiles at 0x8000
+	return emu
+}
+
+// the grey value of the pixel at x, y of the last frame
+func greyAt(emu Emulator, x, y int) byte {
+	return emu.Framebuffer()[(y*160+x)*4]
+}
+
+func TestLayerToggles(t *testing.T) {
+	const bg, window, sprite, blank = 0xaa, 0x55, 0x00, 0xff
+	for _, tc := range []struct {
+		name                                   string
+		toggle                                 func(emu Emulator)
+		wantBG, wantWindow, wantSprite0, want1 byte
+	}{
+		{"all shown", func(emu Emulator) {}, bg, window, sprite, sprite},
+		{"bg hidden", func(emu Emulator) { emu.SetLayerVisible(LayerBG, false) }, blank, window, sprite, sprite},
+		// hidden bg/window pixels are color 0, the window doesn't uncover the bg
+		{"window hidden", func(emu Emulator) { emu.SetLayerVisible(LayerWindow, false) }, bg, blank, sprite, sprite},
+		{"sprites hidden", func(emu Emulator) { emu.SetLayerVisible(LayerSprites, false) }, bg, window, bg, window},
+		{"sprite 0 hidden", func(emu Emulator) { emu.SetSpriteVisible(0, false) }, bg, window, bg, sprite},
+		{"hidden and shown again", func(emu Emulator) {
+			emu.SetLayerVisible(LayerBG, false)
+			emu.SetSpriteVisible(0, false)
+			emu.SetLayerVisible(LayerBG, true)
+			emu.SetSpriteVisible(0, true)
+		}, bg, window, sprite, sprite},
+	} {
+		emu := newLayerTestEmu(t, [2]int{10, 10}, [2]int{120, 100})
+		tc.toggle(emu)
+		runFrames(emu, 1)
+		for _, px := range []struct {
+			name string
+			x, y int
+			want byte
+		}{
+			{"bg", 40, 40, tc.wantBG},
+			{"window", 140, 120, tc.wantWindow},
+			{"sprite 0", 12, 12, tc.wantSprite0},
+			{"sprite 1 (over the window)", 122, 102, tc.want1},
+		} {
+			if got := greyAt(emu, px.x, px.y); got != px.want {
+				t.Errorf("%s: %s pixel is 0x%02x, want 0x%02x", tc.name, px.name, got, px.want)
+			}
+		}
+	}
+}
+
+// hiding layers only changes what's drawn, not timing
+func TestLayerTogglesKeepTiming(t *testing.T) {
+	setup := func(hide bool) func(cs *cpuState) {
+		return func(cs *cpuState) {
+			cs.write(0xff40, 0xb3) // window on at wx 50
+			cs.write(0xff4a, 0)
+			cs.write(0xff4b, 50)
+			cs.LCD.OAM[0], cs.LCD.OAM[1] = 20, 12
+			if hide {
+				for _, layer := range []RenderLayer{LayerBG, LayerWindow, LayerSprites} {
+					cs.SetLayerVisible(layer, false)
+				}
+			}
+		}
+	}
+	if shown, hidden := mode3Len(t, setup(false)), mode3Len(t, setup(true)); shown != hidden {
+		t.Errorf("mode 3 lasted %d dots with everything hidden, %d shown", hidden, shown)
+	}
+}
@@ -8,6 +8,16 @@ type lcd struct {
 	// not marshalled in snapshot
 	framebuffer [160 * 144 * 4]byte
 
+	lastOAMWarningCycles uint
+	lastOAMWarningLine   byte
+
+	// display settings, not hw state, so carried over on snapshot load
+	dmgPalette      DMGPalette
+	colorCorrection ColorCorrection
+	ghosting        lcdGhosting
+	layerToggles    lcdLayerToggles
+	noSpriteLimit   bool
+
 	// everything else marshalled
 
 	FlipRequested bool // for whatever really draws the fb
@@ -28,10 +38,7 @@ type lcd struct {
 	OAM            [160]byte
 	OAMForScanline []oamEntry
 
-	// for oam sprite priority
-	BGMask         [160]bool
-	BGPriorityMask [160]bool
-	SpriteMask     [160]bool
+	Fetcher pixelFetcher
 
 	ScrollY byte
 	ScrollX byte
@@ -69,8 +76,14 @@ type lcd struct {
 	BGWindowMasterEnable        bool
 	BGWindowPrioritiesActive    bool
 
-	CyclesSinceLYInc       uint
-	CyclesSinceVBlankStart uint
+	CyclesSinceLYInc uint
+
+	// LY as seen by the LYC comparator, which lags
+	// behind LY for the first few dots of each line
+	ComparedLY      byte
+	ComparedLYValid bool
+
+	FirstLineAfterEnable bool
 
 	StatIRQSignal bool
 }
@@ -129,16 +142,13 @@ func (lcd *lcd) readSpritePaletteRAMDataReg() byte {
 	return 0xff
 }
 
-var lastOAMWarningCycles uint
-var lastOAMWarningLine byte
-
 func (lcd *lcd) writeOAM(addr uint16, val byte) {
 	if !lcd.DisplayOn || (!lcd.AccessingOAM && !lcd.ReadingData) {
 		lcd.OAM[addr] = val
 	} else {
-		if lcd.CyclesSinceLYInc != lastOAMWarningCycles || lcd.LYReg != lastOAMWarningLine {
-			lastOAMWarningCycles = lcd.CyclesSinceLYInc
-			lastOAMWarningLine = lcd.LYReg
+		if lcd.CyclesSinceLYInc != lcd.lastOAMWarningCycles || lcd.LYReg != lcd.lastOAMWarningLine {
+			lcd.lastOAMWarningCycles = lcd.CyclesSinceLYInc
+			lcd.lastOAMWarningLine = lcd.LYReg
 			// TODO: figure out if this is nominal
 			//fmt.Println("TOUCHED OAM DURING USE: CyclesSinceLYInc", lcd.CyclesSinceLYInc, "LYReg", lcd.LYReg)
 		}
@@ -188,69 +198,90 @@ func (lcd *lcd) readBankReg() byte {
 
 func (cs *cpuState) updateStatIRQ() {
 	lastSignal := cs.LCD.StatIRQSignal
-	cs.LCD.StatIRQSignal = (cs.LCD.LYCInterrupt && cs.LCD.LYReg == cs.LCD.LYCReg) ||
+	cs.LCD.StatIRQSignal = (cs.LCD.LYCInterrupt && cs.LCD.lycMatch()) ||
 		(cs.LCD.HBlankInterrupt && cs.LCD.InHBlank) ||
 		(cs.LCD.OAMInterrupt && cs.LCD.AccessingOAM) ||
+		// NOTE: TCAGBD claims the oam flag triggers this as well
 		((cs.LCD.VBlankInterrupt || cs.LCD.OAMInterrupt) && cs.LCD.InVBlank)
 	if !lastSignal && cs.LCD.StatIRQSignal { // rising edge only
 		cs.LCDStatIRQ = true
 	}
 }
 
-func (lcd *lcd) startHBlankAndDoRender(cs *cpuState) {
+func (lcd *lcd) startHBlank(cs *cpuState) {
 	lcd.ReadingData = false
 	lcd.InHBlank = true
-	lcd.renderScanline()
 	cs.updateStatIRQ()
 
-	cs.runHblankDMA()
+	cs.startHblankDMA()
 }
 
 func (lcd *lcd) startReadData() {
+	if lcd.LYReg == lcd.WindowY && !lcd.PassedWindowY {
+		lcd.PassedWindowY = true
+		lcd.LWY = 0
+	}
 	lcd.parseOAMForScanline(lcd.LYReg)
 	lcd.AccessingOAM = false
 	lcd.ReadingData = true
+	lcd.startPixelTransfer()
 }
 
-func (lcd *lcd) handleHBlankEnd(cs *cpuState) {
-	lcd.CyclesSinceLYInc = 0
-	lcd.InHBlank = false
-	lcd.LYReg++
-	if lcd.isWindowVisible() {
-		lcd.LWY++
+func (lcd *lcd) lycMatch() bool {
+	return lcd.ComparedLYValid && lcd.ComparedLY == lcd.LYCReg
+}
+
+// dot 4 of each line: LY changes are now visible
+// to the comparator, and mode 2 or mode 1 begins
+func (lcd *lcd) handleLineStart(cs *cpuState) {
+	lcd.ComparedLYValid = true
+	lcd.ComparedLY = lcd.LYReg
+
+	if lcd.InVBlank {
+		if lcd.LYReg == 153 {
+			// LY reads 0 early on line 153, comparator sees 0 at dot 8
+			lcd.LYReg = 0
+		}
+		return
 	}
 
-	if lcd.LYReg == 144 && !lcd.InVBlank {
+	if lcd.LYReg == 144 {
+		lcd.InHBlank = false
 		lcd.InVBlank = true
 		cs.VBlankIRQ = true
 
 		if lcd.PastFirstFrame {
-			lcd.FlipRequested = true
+			lcd.requestFlip()
 		} else {
 			lcd.PastFirstFrame = true
 		}
+		return
+	}
+
+	if !lcd.FirstLineAfterEnable {
+		lcd.InHBlank = false
+		lcd.AccessingOAM = true
 	}
 }
 
-func (lcd *lcd) handleVBlank(cs *cpuState) {
-	lcd.CyclesSinceVBlankStart += 4
-	if lcd.CyclesSinceVBlankStart == 456*10 {
+func (lcd *lcd) handleLineEnd() {
+	lcd.CyclesSinceLYInc = 0
+	lcd.FirstLineAfterEnable = false
+	if lcd.Fetcher.FetchingWindow {
+		lcd.LWY++
+		lcd.Fetcher.FetchingWindow = false
+	}
+
+	if lcd.InVBlank && (lcd.LYReg == 0 || lcd.LYReg == 153) {
+		// end of line 153, LY is already 0 so the comparator is left alone
 		lcd.LYReg = 0
-		lcd.PassedWindowY = false
 		lcd.InVBlank = false
-		lcd.CyclesSinceLYInc = 0
-		lcd.CyclesSinceVBlankStart = 0
+		lcd.PassedWindowY = false
+		return
 	}
-	// NOTE: TCAGBD claims the oam flag triggers this as well
-	cs.updateStatIRQ()
-}
 
-func (lcd *lcd) startAccessingOAM() {
-	lcd.AccessingOAM = true
-	if lcd.LYReg == lcd.WindowY {
-		lcd.PassedWindowY = true
-		lcd.LWY = lcd.LYReg - lcd.WindowY
-	}
+	lcd.LYReg++
+	lcd.ComparedLYValid = false
 }
 
 func (lcd *lcd) runCycle(cs *cpuState) {
@@ -259,28 +290,27 @@ func (lcd *lcd) runCycle(cs *cpuState) {
 	}
 
 	lcd.CyclesSinceLYInc++
-	if (lcd.CyclesSinceLYInc & 3) == 0 {
-		switch lcd.CyclesSinceLYInc {
-		case 4:
-			if !lcd.InVBlank {
-				lcd.startAccessingOAM()
-			}
-			cs.updateStatIRQ()
-		case 80:
-			if lcd.AccessingOAM {
-				lcd.startReadData()
-			}
-		case 252:
-			if lcd.ReadingData {
-				lcd.startHBlankAndDoRender(cs)
-			}
-		case 456:
-			lcd.handleHBlankEnd(cs)
+	if lcd.ReadingData && lcd.runPixelTransferDot() {
+		lcd.startHBlank(cs)
+	}
+
+	switch lcd.CyclesSinceLYInc {
+	case 4:
+		lcd.handleLineStart(cs)
+	case 8:
+		if lcd.InVBlank && lcd.LYReg == 0 {
+			lcd.ComparedLY = 0
 		}
-		if lcd.InVBlank {
-			lcd.handleVBlank(cs)
+	case 80:
+		if lcd.AccessingOAM || lcd.FirstLineAfterEnable {
+			lcd.startReadData()
 		}
+	case 456:
+		lcd.handleLineEnd()
+		cs.Mem.DMAHblankPending = false // missed it if the cpu was halted
 	}
+
+	cs.updateStatIRQ()
 }
 
 type tileAttrs struct {
@@ -290,38 +320,38 @@ type tileAttrs struct {
 	hasPriority  bool
 }
 
-func (lcd *lcd) getTilePixel(tdataAddr uint16, attr tileAttrs, tileNum, x, y byte) byte {
+// returns the addr of the low byte of the tile's row, the high byte follows it
+func (lcd *lcd) getTileDataAddr(tdataAddr uint16, attr tileAttrs, tileNum, y byte) uint16 {
 	if tdataAddr == 0x0800 { // 0x8000 relative
 		tileNum = byte(int(int8(tileNum)) + 128)
 	}
-	mapBitY, mapBitX := y&0x07, x&0x07
-	if attr.xFlip {
-		mapBitX = 7 - mapBitX
-	}
+	mapBitY := y & 0x07
 	if attr.yFlip {
 		mapBitY = 7 - mapBitY
 	}
 	if attr.useHighBank {
 		tdataAddr += 0x2000
 	}
-	dataByteL := lcd.VideoRAM[tdataAddr+(uint16(tileNum)<<4)+(uint16(mapBitY)<<1)]
-	dataByteH := lcd.VideoRAM[tdataAddr+(uint16(tileNum)<<4)+(uint16(mapBitY)<<1)+1]
-	dataBitL := (dataByteL >> (7 - mapBitX)) & 0x1
-	dataBitH := (dataByteH >> (7 - mapBitX)) & 0x1
-	return (dataBitH << 1) | dataBitL
+	return tdataAddr + (uint16(tileNum) << 4) + (uint16(mapBitY) << 1)
+}
+func (lcd *lcd) getTilePixel(tdataAddr uint16, attr tileAttrs, tileNum, x, y byte) byte {
+	addr := lcd.getTileDataAddr(tdataAddr, attr, tileNum, y)
+	return tileRowPixel(lcd.VideoRAM[addr], lcd.VideoRAM[addr+1], x&0x07, attr.xFlip)
 }
 func (lcd *lcd) getTileNum(tmapAddr uint16, x, y byte) byte {
 	tileNumY, tileNumX := uint16(y>>3), uint16(x>>3)
 	tileNum := lcd.VideoRAM[tmapAddr+tileNumY*32+tileNumX]
 	return tileNum
 }
-func (lcd *lcd) getTileAttrs(tmapAddr uint16, x, y byte) tileAttrs {
+func (lcd *lcd) getTileAttrByte(tmapAddr uint16, x, y byte) byte {
 	if !lcd.CGBMode {
-		return tileAttrs{}
+		return 0
 	}
-	attr := tileAttrs{}
 	tileNumY, tileNumX := uint16(y>>3), uint16(x>>3)
-	attrByte := lcd.VideoRAM[0x2000+tmapAddr+tileNumY*32+tileNumX]
+	return lcd.VideoRAM[0x2000+tmapAddr+tileNumY*32+tileNumX]
+}
+func tileAttrsFromByte(attrByte byte) tileAttrs {
+	attr := tileAttrs{}
 	attr.bgPaletteNum = attrByte & 0x07
 	boolsFromByte(attrByte,
 		&attr.hasPriority,
@@ -336,101 +366,25 @@ func (lcd *lcd) getTileAttrs(tmapAddr uint16, x, y byte) tileAttrs {
 	return attr
 }
 
-func (lcd *lcd) DumpTiles() {
-	tileAttrs := tileAttrs{}
-	pixData := []byte{}
-	for i := 0; i < len(lcd.VideoRAM)/16; i += 16 {
-		dataAddr := uint16(i / 256 * (16 * 256))
-		for y := 0; y < 8; y++ {
-			for j := 0; j < 16; j++ {
-				for x := 0; x < 8; x++ {
-					tileNum := byte(i + j)
-					pix := lcd.getTilePixel(dataAddr, tileAttrs, tileNum, byte(x), byte(y))
-					r, g, b := lcd.applyBGPalettes(tileAttrs, pix)
-					pixData = append(pixData, []byte{r, g, b}...)
-				}
-			}
-		}
-	}
-	writeTgaRGB("tiledata.tga", 16*8, len(pixData)/(16*8*3), pixData)
-}
-
-func (lcd *lcd) getBGPixel(x, y byte) (byte, tileAttrs) {
-	mapAddr := lcd.getBGTileMapAddr()
-	dataAddr := lcd.getBGAndWindowTileDataAddr()
-	tileNum := lcd.getTileNum(mapAddr, x, y)
-	tileAttrs := lcd.getTileAttrs(mapAddr, x, y)
-	return lcd.getTilePixel(dataAddr, tileAttrs, tileNum, x, y), tileAttrs
-}
-
-func (lcd *lcd) getWindowPixel(x, y byte) (byte, tileAttrs) {
-	mapAddr := lcd.getWindowTileMapAddr()
-	dataAddr := lcd.getBGAndWindowTileDataAddr()
-	tileNum := lcd.getTileNum(mapAddr, x, y)
-	tileAttrs := lcd.getTileAttrs(mapAddr, x, y)
-	return lcd.getTilePixel(dataAddr, tileAttrs, tileNum, x, y), tileAttrs
-}
-
-func (lcd *lcd) getSpritePixel(e *oamEntry, x, y byte) (byte, byte, byte, bool) {
-	tileX := byte(int16(x) - e.x)
-	tileY := byte(int16(y) - e.y)
-	if e.xFlip() {
-		tileX = 7 - tileX
-	}
-	if e.yFlip() {
-		tileY = e.height - 1 - tileY
-	}
-	tileNum := e.tileNum
-	if e.height == 16 {
-		tileNum &^= 0x01
-		if tileY >= 8 {
-			tileNum++
-		}
-	}
-	tileAttrs := tileAttrs{
-		useHighBank: e.cgbUseHighBank(),
-	}
-	rawPixel := lcd.getTilePixel(0x0000, tileAttrs, tileNum, tileX, tileY) // addr 8000 relative
-	if rawPixel == 0 {
-		return 0, 0, 0, false // transparent
-	}
-	r, g, b := lcd.applySpritePalettes(e, rawPixel)
-	return r, g, b, true
-}
-
-func cgbToRGB(cgbColor uint16) (byte, byte, byte) {
-	r := byte(cgbColor&0x1f) << 3
-	g := byte(cgbColor>>5) << 3
-	b := byte(cgbColor>>10) << 3
-	// TODO: accurate CGB color mixing
-	return r, g, b
-}
-
 func (lcd *lcd) applySpritePalettes(e *oamEntry, rawPixel byte) (byte, byte, byte) {
 	if lcd.CGBMode {
-		palNum := e.cgbPalNumber()
-		cVal := uint16(lcd.SpritePaletteRAM[8*palNum+2*rawPixel])
-		cVal |= uint16(lcd.SpritePaletteRAM[8*palNum+2*rawPixel+1]) << 8
-		return cgbToRGB(cVal)
+		cVal := cgbPaletteColor(&lcd.SpritePaletteRAM, e.cgbPalNumber(), rawPixel)
+		return cgbToRGB(cVal, lcd.colorCorrection)
 	}
-	palReg := lcd.ObjectPalette0Reg
+	palReg, colors := lcd.ObjectPalette0Reg, &lcd.dmgPalette.OBJ0
 	if e.palSelector() {
-		palReg = lcd.ObjectPalette1Reg
+		palReg, colors = lcd.ObjectPalette1Reg, &lcd.dmgPalette.OBJ1
 	}
-	return lcd.applyCustomPalette((palReg >> (rawPixel * 2)) & 0x03)
+	return applyDMGPalette(colors, (palReg>>(rawPixel*2))&0x03)
 }
 
-var standardPalette = [][]byte{
-	{0x00, 0x00, 0x00},
-	{0x55, 0x55, 0x55},
-	{0xaa, 0xaa, 0xaa},
-	{0xff, 0xff, 0xff},
+func cgbPaletteColor(paletteRAM *[64]byte, palNum, rawPixel byte) uint16 {
+	return uint16(paletteRAM[8*palNum+2*rawPixel]) | uint16(paletteRAM[8*palNum+2*rawPixel+1])<<8
 }
 
-func (lcd *lcd) applyCustomPalette(val byte) (byte, byte, byte) {
-	// TODO: actual custom palette choices stored in lcd
-	outVal := standardPalette[3-val]
-	return outVal[0], outVal[1], outVal[2]
+func applyDMGPalette(colors *[4]RGB, shade byte) (byte, byte, byte) {
+	c := colors[shade]
+	return c.R, c.G, c.B
 }
 
 // 0x8000 relative
@@ -457,46 +411,67 @@ func (lcd *lcd) getBGAndWindowTileDataAddr() uint16 {
 	return 0x0800
 }
 
+// exported so OAMForScanline survives a snapshot taken mid-line
 type oamEntry struct {
-	y         int16
-	x         int16
-	height    byte
-	tileNum   byte
-	flagsByte byte
+	Index     byte
+	Y         int16
+	X         int16
+	Height    byte
+	TileNum   byte
+	FlagsByte byte
+
+	// past the hardware's 10 per line, only found with the limit off
+	OverLimit bool
 }
 
-func (e *oamEntry) behindBG() bool    { return e.flagsByte&0x80 != 0 }
-func (e *oamEntry) yFlip() bool       { return e.flagsByte&0x40 != 0 }
-func (e *oamEntry) xFlip() bool       { return e.flagsByte&0x20 != 0 }
-func (e *oamEntry) palSelector() bool { return e.flagsByte&0x10 != 0 }
+func (e *oamEntry) behindBG() bool    { return e.FlagsByte&0x80 != 0 }
+func (e *oamEntry) yFlip() bool       { return e.FlagsByte&0x40 != 0 }
+func (e *oamEntry) xFlip() bool       { return e.FlagsByte&0x20 != 0 }
+func (e *oamEntry) palSelector() bool { return e.FlagsByte&0x10 != 0 }
 
-func (e *oamEntry) cgbUseHighBank() bool { return e.flagsByte&0x08 != 0 }
-func (e *oamEntry) cgbPalNumber() byte   { return e.flagsByte & 0x07 }
+func (e *oamEntry) cgbUseHighBank() bool { return e.FlagsByte&0x08 != 0 }
+func (e *oamEntry) cgbPalNumber() byte   { return e.FlagsByte & 0x07 }
 
 func yInSprite(y byte, spriteY int16, height int) bool {
 	return int16(y) >= spriteY && int16(y) < spriteY+int16(height)
 }
-func (lcd *lcd) parseOAMForScanline(scanline byte) {
-	height := 8
+
+func (lcd *lcd) spriteHeight() int {
 	if lcd.BigSprites {
-		height = 16
+		return 16
+	}
+	return 8
+}
+
+func (lcd *lcd) oamEntryAt(i int, height int) oamEntry {
+	addr := i * 4
+	return oamEntry{
+		Index:     byte(i),
+		Y:         int16(lcd.OAM[addr]) - 16,
+		X:         int16(lcd.OAM[addr+1]) - 8,
+		Height:    byte(height),
+		TileNum:   lcd.OAM[addr+2],
+		FlagsByte: lcd.OAM[addr+3],
 	}
+}
+
+func (lcd *lcd) parseOAMForScanline(scanline byte) {
+	height := lcd.spriteHeight()
 
 	// reslice so we don't realloc
 	lcd.OAMForScanline = lcd.OAMForScanline[:0]
 
 	// search all sprites, limit total found to 10 per scanline
-	for i := 0; len(lcd.OAMForScanline) < 10 && i < 40; i++ {
-		addr := i * 4
-		spriteY := int16(lcd.OAM[addr]) - 16
-		if yInSprite(scanline, spriteY, height) {
-			lcd.OAMForScanline = append(lcd.OAMForScanline, oamEntry{
-				y:         spriteY,
-				x:         int16(lcd.OAM[addr+1]) - 8,
-				height:    byte(height),
-				tileNum:   lcd.OAM[addr+2],
-				flagsByte: lcd.OAM[addr+3],
-			})
+	// (unless that's turned off, see SetSpriteLimit)
+	limit := 10
+	if lcd.noSpriteLimit {
+		limit = 40
+	}
+	for i := 0; len(lcd.OAMForScanline) < limit && i < 40; i++ {
+		e := lcd.oamEntryAt(i, height)
+		if yInSprite(scanline, e.Y, height) {
+			e.OverLimit = len(lcd.OAMForScanline) >= 10
+			lcd.OAMForScanline = append(lcd.OAMForScanline, e)
 		}
 	}
 
@@ -524,116 +499,19 @@ func (lcd *lcd) parseOAMForScanline(scanline byte) {
 
 type sortableOAM []oamEntry
 
-func (s sortableOAM) Less(i, j int) bool { return s[i].x < s[j].x }
+func (s sortableOAM) Less(i, j int) bool { return s[i].X < s[j].X }
 func (s sortableOAM) Len() int           { return len(s) }
 func (s sortableOAM) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
-func (lcd *lcd) isWindowVisible() bool {
-	return lcd.WindowY <= 143 && lcd.WindowX <= 166
-}
-
-func (lcd *lcd) renderScanline() {
-	if lcd.LYReg >= 144 {
-		return
-	}
-	lcd.fillScanline(0)
-
-	y := lcd.LYReg
-
-	for i := 0; i < 160; i++ {
-		lcd.BGMask[i] = false
-		lcd.BGPriorityMask[i] = false
-		lcd.SpriteMask[i] = false
-	}
-
-	if lcd.BGWindowMasterEnable {
-
-		mightDrawWindow := lcd.DisplayWindow && lcd.PassedWindowY
-		winStartX := int(lcd.WindowX) - 7
-
-		bgEndX := 160
-		if mightDrawWindow && winStartX < bgEndX {
-			bgEndX = winStartX
-		}
-
-		bgY := y + lcd.ScrollY
-		for x := 0; x < bgEndX; x++ {
-			bgX := byte(x) + lcd.ScrollX
-			pixel, attrs := lcd.getBGPixel(bgX, bgY)
-			if pixel != 0 {
-				lcd.BGMask[x] = true
-			}
-			if attrs.hasPriority {
-				lcd.BGPriorityMask[x] = true
-			}
-			r, g, b := lcd.applyBGPalettes(attrs, pixel)
-			lcd.setFramebufferPixel(byte(x), y, r, g, b)
-		}
-
-		if mightDrawWindow {
-			x := winStartX
-			if x < 0 {
-				x = 0
-			}
-			for ; x < 160; x++ {
-				pixel, attrs := lcd.getWindowPixel(byte(x-winStartX), lcd.LWY)
-				if pixel != 0 {
-					lcd.BGMask[x] = true
-				}
-				if attrs.hasPriority {
-					lcd.BGPriorityMask[x] = true
-				}
-				r, g, b := lcd.applyBGPalettes(attrs, pixel)
-				lcd.setFramebufferPixel(byte(x), y, r, g, b)
-			}
-		}
-	}
-
-	if lcd.DisplaySprites {
-		for i := range lcd.OAMForScanline {
-			e := &lcd.OAMForScanline[i]
-			lcd.renderSpriteAtScanline(e, y)
-		}
-	}
-}
-
 func (lcd *lcd) applyBGPalettes(attrs tileAttrs, rawPixel byte) (byte, byte, byte) {
 	if lcd.CGBMode {
-		cVal := uint16(lcd.BGPaletteRAM[8*attrs.bgPaletteNum+2*rawPixel])
-		cVal |= uint16(lcd.BGPaletteRAM[8*attrs.bgPaletteNum+2*rawPixel+1]) << 8
-		return cgbToRGB(cVal)
+		cVal := cgbPaletteColor(&lcd.BGPaletteRAM, attrs.bgPaletteNum, rawPixel)
+		return cgbToRGB(cVal, lcd.colorCorrection)
 	}
 	palettedPixel := (lcd.BackgroundPaletteReg >> (rawPixel * 2)) & 0x03
-	return lcd.applyCustomPalette(palettedPixel)
-}
-
-func (lcd *lcd) renderSpriteAtScanline(e *oamEntry, y byte) {
-	startX := byte(0)
-	if e.x > 0 {
-		startX = byte(e.x)
-	}
-	endX := byte(e.x + 8)
-	for x := startX; x < endX && x < 160; x++ {
-		if !lcd.SpriteMask[x] {
-			if r, g, b, a := lcd.getSpritePixel(e, x, y); a {
-				lcd.SpriteMask[x] = true
-				hideSprite := lcd.BGWindowPrioritiesActive && (lcd.BGPriorityMask[x] || e.behindBG()) && lcd.BGMask[x]
-				if !hideSprite {
-					lcd.setFramebufferPixel(x, y, r, g, b)
-				}
-			}
-		}
-	}
+	return applyDMGPalette(&lcd.dmgPalette.BG, palettedPixel)
 }
 
-func (lcd *lcd) getFramebufferPixel(xByte, yByte byte) (byte, byte, byte) {
-	x, y := int(xByte), int(yByte)
-	yIdx := y * 160 * 4
-	r := lcd.framebuffer[yIdx+x*4+0]
-	g := lcd.framebuffer[yIdx+x*4+1]
-	b := lcd.framebuffer[yIdx+x*4+2]
-	return r, g, b
-}
 func (lcd *lcd) setFramebufferPixel(xByte, yByte, r, g, b byte) {
 	x, y := int(xByte), int(yByte)
 	yIdx := y * 160 * 4
@@ -642,14 +520,16 @@ func (lcd *lcd) setFramebufferPixel(xByte, yByte, r, g, b byte) {
 	lcd.framebuffer[yIdx+x*4+2] = b
 	lcd.framebuffer[yIdx+x*4+3] = 0xff
 }
-func (lcd *lcd) fillScanline(pixel byte) {
-	r, g, b := lcd.applyBGPalettes(tileAttrs{}, pixel)
-	yIdx := int(lcd.LYReg) * 160 * 4
-	for x := 0; x < 160; x++ {
-		lcd.framebuffer[yIdx+x*4+0] = r
-		lcd.framebuffer[yIdx+x*4+1] = g
-		lcd.framebuffer[yIdx+x*4+2] = b
-		lcd.framebuffer[yIdx+x*4+3] = 0xff
+func (lcd *lcd) blankFramebuffer() {
+	r, g, b := byte(0xff), byte(0xff), byte(0xff)
+	if !lcd.CGBMode {
+		r, g, b = applyDMGPalette(&lcd.dmgPalette.BG, 0)
+	}
+	for i := 0; i < len(lcd.framebuffer); i += 4 {
+		lcd.framebuffer[i+0] = r
+		lcd.framebuffer[i+1] = g
+		lcd.framebuffer[i+2] = b
+		lcd.framebuffer[i+3] = 0xff
 	}
 }
 
@@ -682,6 +562,7 @@ func (lcd *lcd) writeWindowX(val byte) {
 }
 
 func (lcd *lcd) writeControlReg(val byte) {
+	wasOn := lcd.DisplayOn
 	bgBit := &lcd.BGWindowMasterEnable
 	if lcd.CGBMode {
 		bgBit = &lcd.BGWindowPrioritiesActive
@@ -697,11 +578,49 @@ func (lcd *lcd) writeControlReg(val byte) {
 		bgBit,
 	)
 
-	if !lcd.DisplayOn {
-		lcd.PastFirstFrame = false
-		lcd.LYReg = 0
+	if wasOn && !lcd.DisplayOn {
+		lcd.turnOff()
+	} else if !wasOn && lcd.DisplayOn {
+		lcd.turnOn()
 	}
 }
+
+func (lcd *lcd) turnOff() {
+	lcd.LYReg = 0
+	lcd.CyclesSinceLYInc = 0
+	lcd.InVBlank = false
+	lcd.InHBlank = false
+	lcd.AccessingOAM = false
+	lcd.ReadingData = false
+	lcd.PassedWindowY = false
+	lcd.Fetcher = pixelFetcher{}
+	lcd.StatIRQSignal = false
+
+	// screen goes blank until the first full frame after turning back on
+	lcd.PastFirstFrame = false
+	lcd.blankFramebuffer()
+	lcd.requestFlip()
+}
+
+func (lcd *lcd) requestFlip() {
+	lcd.ghosting.blendFrame(lcd.framebuffer[:])
+	lcd.FlipRequested = true
+}
+
+func (lcd *lcd) displayedFramebuffer() []byte {
+	if lcd.ghosting.response.enabled() {
+		return lcd.ghosting.framebuffer[:]
+	}
+	return lcd.framebuffer[:]
+}
+
+func (lcd *lcd) turnOn() {
+	// first line is 4 dots short and skips mode 2, LY=LYC compares right away
+	lcd.CyclesSinceLYInc = 4
+	lcd.FirstLineAfterEnable = true
+	lcd.ComparedLY = 0
+	lcd.ComparedLYValid = true
+}
 func (lcd *lcd) readControlReg() byte {
 	bgBit := lcd.BGWindowMasterEnable
 	if lcd.CGBMode {
@@ -738,7 +657,7 @@ func (lcd *lcd) readStatusReg() byte {
 		lcd.OAMInterrupt,
 		lcd.VBlankInterrupt,
 		lcd.HBlankInterrupt,
-		lcd.DisplayOn && (lcd.LYReg == lcd.LYCReg),
+		lcd.lycMatch(),
 		lcd.DisplayOn && (lcd.AccessingOAM || lcd.ReadingData),
 		lcd.DisplayOn && (lcd.InVBlank || lcd.ReadingData),
 	)
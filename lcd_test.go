@@ -0,0 +1,197 @@
+package dmgo
+
+import "testing"
+
+// mode3Len is how many dots mode 3 lasts on line 10 after setup
+func mode3Len(t *testing.T, setup func(cs *cpuState)) uint {
+	t.Helper()
+	cs, err := newState(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cs.LCD.OAM {
+		cs.LCD.OAM[i] = 0
+	}
+	setup(cs)
+	for cs.LCD.LYReg != 10 || !cs.LCD.ReadingData {
+		cs.runCycles(1)
+	}
+	start := cs.LCD.CyclesSinceLYInc
+	for cs.LCD.ReadingData {
+		cs.runCycles(1)
+	}
+	return cs.LCD.CyclesSinceLYInc - start
+}
+
+func TestMode3Length(t *testing.T) {
+	oneSprite := func(x byte) func(cs *cpuState) {
+		return func(cs *cpuState) {
+			cs.write(0xff40, 0x93) // sprites on
+			cs.LCD.OAM[0], cs.LCD.OAM[1] = 20, x
+		}
+	}
+	for _, tc := range []struct {
+		name  string
+		setup func(cs *cpuState)
+		want  uint
+	}{
+		{"plain", func(cs *cpuState) {}, 172},
+		{"scx 3", func(cs *cpuState) { cs.write(0xff43, 3) }, 175},
+		{"scx 7", func(cs *cpuState) { cs.write(0xff43, 7) }, 179},
+		{"window at wx 7", func(cs *cpuState) { cs.write(0xff40, 0xb1); cs.write(0xff4a, 0); cs.write(0xff4b, 7) }, 178},
+		{"window at wx 50", func(cs *cpuState) { cs.write(0xff40, 0xb1); cs.write(0xff4a, 0); cs.write(0xff4b, 50) }, 178},
+		{"window below the line", func(cs *cpuState) { cs.write(0xff40, 0xb1); cs.write(0xff4a, 20); cs.write(0xff4b, 7) }, 172},
+		{"sprite at x 0", oneSprite(0), 183},
+		{"sprite at x 8", oneSprite(8), 183},
+		{"sprite at x 9", oneSprite(9), 182},
+		{"sprite at x 12", oneSprite(12), 179},
+		{"sprite at x 13", oneSprite(13), 178},
+		{"sprite at x 16", oneSprite(16), 183},
+		{"sprite at x 167", oneSprite(167), 178},
+		{"sprite offscreen at x 168", oneSprite(168), 172},
+		{"sprites disabled", func(cs *cpuState) { oneSprite(8)(cs); cs.write(0xff40, 0x91) }, 172},
+		{"10 sprites at x 8", func(cs *cpuState) {
+			cs.write(0xff40, 0x93)
+			for i := 0; i < 10; i++ {
+				cs.LCD.OAM[i*4], cs.LCD.OAM[i*4+1] = 20, 8
+			}
+		}, 237},
+	} {
+		if got := mode3Len(t, tc.setup); got != tc.want {
+			t.Errorf("%s: mode 3 lasted %d dots, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// runs a fresh cpuState to the given line and dot of a frame, counting
+// lines the way the hardware does (so line 153 is the one where LY reads 0,
+// and line 154 is the next frame's line 0)
+func runToDot(t *testing.T, lyc byte, line, dot int) *cpuState {
+	t.Helper()
+	cs, err := newState(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.write(0xff45, lyc)
+	for cs.LCD.LYReg != 1 {
+		cs.runCycles(1)
+	}
+	for cs.LCD.LYReg != 0 || cs.LCD.InVBlank || cs.LCD.CyclesSinceLYInc != 0 {
+		cs.runCycles(1)
+	}
+	cs.runCycles(uint(line*456 + dot))
+	return cs
+}
+
+func TestLineTimingSTAT(t *testing.T) {
+	for _, tc := range []struct {
+		lyc       byte
+		line, dot int
+		wantLY    byte
+		wantSTAT  byte
+	}{
+		// a visible line: mode 0 until dot 4, then modes 2, 3, 0
+		{lyc: 0xff, line: 10, dot: 0, wantLY: 10, wantSTAT: 0x80},
+		{lyc: 0xff, line: 10, dot: 3, wantLY: 10, wantSTAT: 0x80},
+		{lyc: 0xff, line: 10, dot: 4, wantLY: 10, wantSTAT: 0x82},
+		{lyc: 0xff, line: 10, dot: 79, wantLY: 10, wantSTAT: 0x82},
+		{lyc: 0xff, line: 10, dot: 80, wantLY: 10, wantSTAT: 0x83},
+		{lyc: 0xff, line: 10, dot: 251, wantLY: 10, wantSTAT: 0x83},
+		{lyc: 0xff, line: 10, dot: 252, wantLY: 10, wantSTAT: 0x80},
+		{lyc: 0xff, line: 10, dot: 455, wantLY: 10, wantSTAT: 0x80},
+
+		// the comparator sees the new LY at dot 4
+		{lyc: 10, line: 10, dot: 3, wantLY: 10, wantSTAT: 0x80},
+		{lyc: 10, line: 10, dot: 4, wantLY: 10, wantSTAT: 0x86},
+		{lyc: 10, line: 10, dot: 455, wantLY: 10, wantSTAT: 0x84},
+		{lyc: 10, line: 11, dot: 0, wantLY: 11, wantSTAT: 0x80},
+
+		// vblank starts at dot 4 of line 144
+		{lyc: 0xff, line: 144, dot: 3, wantLY: 144, wantSTAT: 0x80},
+		{lyc: 0xff, line: 144, dot: 4, wantLY: 144, wantSTAT: 0x81},
+
+		// line 153: LY reads 0 from dot 4, the comparator
+		// sees 153 for dots 4-7 and 0 from dot 8 on
+		{lyc: 153, line: 153, dot: 0, wantLY: 153, wantSTAT: 0x81},
+		{lyc: 153, line: 153, dot: 4, wantLY: 0, wantSTAT: 0x85},
+		{lyc: 153, line: 153, dot: 7, wantLY: 0, wantSTAT: 0x85},
+		{lyc: 153, line: 153, dot: 8, wantLY: 0, wantSTAT: 0x81},
+		{lyc: 0, line: 153, dot: 4, wantLY: 0, wantSTAT: 0x81},
+		{lyc: 0, line: 153, dot: 8, wantLY: 0, wantSTAT: 0x85},
+		{lyc: 0, line: 153, dot: 455, wantLY: 0, wantSTAT: 0x85},
+
+		// ...and the match carries on into line 0 without a gap
+		{lyc: 0, line: 154, dot: 0, wantLY: 0, wantSTAT: 0x84},
+		{lyc: 0, line: 154, dot: 4, wantLY: 0, wantSTAT: 0x86},
+		{lyc: 152, line: 152, dot: 4, wantLY: 152, wantSTAT: 0x85},
+		{lyc: 152, line: 153, dot: 0, wantLY: 153, wantSTAT: 0x81},
+		{lyc: 1, line: 154, dot: 80, wantLY: 0, wantSTAT: 0x83},
+	} {
+		cs := runToDot(t, tc.lyc, tc.line, tc.dot)
+		ly, stat := cs.read(0xff44), cs.read(0xff41)
+		if ly != tc.wantLY || stat != tc.wantSTAT {
+			t.Errorf("lyc %d, line %d dot %d: got LY %d STAT %02x, want LY %d STAT %02x",
+				tc.lyc, tc.line, tc.dot, ly, stat, tc.wantLY, tc.wantSTAT)
+		}
+	}
+}
+
+func TestLCDEnableTiming(t *testing.T) {
+	cs := runToDot(t, 0xff, 50, 100)
+	cs.write(0xff40, 0x11)
+	if ly, stat := cs.read(0xff44), cs.read(0xff41); ly != 0 || stat != 0x80 {
+		t.Errorf("lcd off: got LY %d STAT %02x, want LY 0 STAT 80", ly, stat)
+	}
+	cs.write(0xff40, 0x91)
+
+	// the first line after enabling skips mode 2 and runs 4 dots short
+	ran := 0
+	for _, tc := range []struct {
+		dot      int
+		wantLY   byte
+		wantSTAT byte
+	}{
+		{0, 0, 0x80}, {75, 0, 0x80}, {76, 0, 0x83}, {247, 0, 0x83}, {248, 0, 0x80},
+		{451, 0, 0x80}, {452, 1, 0x80}, {456, 1, 0x82}, {532, 1, 0x83},
+	} {
+		cs.runCycles(uint(tc.dot - ran))
+		ran = tc.dot
+		if ly, stat := cs.read(0xff44), cs.read(0xff41); ly != tc.wantLY || stat != tc.wantSTAT {
+			t.Errorf("dot %d after enable: got LY %d STAT %02x, want LY %d STAT %02x",
+				tc.dot, ly, stat, tc.wantLY, tc.wantSTAT)
+		}
+	}
+}
+
+func TestSpriteLimit(t *testing.T) {
+	// 12 sprites across one line, every 12 pixels
+	sprites := [][2]int{}
+	for i := 0; i < 12; i++ {
+		sprites = append(sprites, [2]int{i * 12, 20})
+	}
+	for _, limitOn := range []bool{true, false} {
+		emu := newLayerTestEmu(t, sprites...)
+		emu.SetSpriteLimit(limitOn)
+		runFrames(emu, 1)
+		for i, pos := range sprites {
+			drawn := greyAt(emu, pos[0]+2, pos[1]+2) == 0x00
+			if want := !limitOn || i < 10; drawn != want {
+				t.Errorf("limit on %v: sprite %d drawn %v, want %v", limitOn, i, drawn, want)
+			}
+		}
+	}
+
+	// but mode 3 still only stalls for the first 10
+	twelveSprites := func(limitOn bool) func(cs *cpuState) {
+		return func(cs *cpuState) {
+			cs.SetSpriteLimit(limitOn)
+			cs.write(0xff40, 0x93)
+			for i := 0; i < 12; i++ {
+				cs.LCD.OAM[i*4], cs.LCD.OAM[i*4+1] = 20, 8
+			}
+		}
+	}
+	if on, off := mode3Len(t, twelveSprites(true)), mode3Len(t, twelveSprites(false)); on != 237 || off != on {
+		t.Errorf("mode 3 with 12 sprites lasted %d dots with the limit, %d without, want 237 for both", on, off)
+	}
+}
@@ -16,24 +16,24 @@ import (
 // but list a cartType that ostensibly
 // doesn't. Real gameboys don't care,
 // do we?
-func makeMBC(cartInfo *CartInfo) mbc {
+func makeMBC(cartInfo *CartInfo) (mbc, error) {
 	switch cartInfo.CartridgeType {
 	case 0:
-		return &nullMBC{}
+		return &nullMBC{}, nil
 	case 1, 2, 3:
-		return &mbc1{}
+		return &mbc1{}, nil
 	case 5, 6:
-		return &mbc2{}
+		return &mbc2{}, nil
 	case 8, 9:
-		return &nullMBC{} // but this time with RAM
+		return &nullMBC{}, nil // but this time with RAM
 	case 11, 12, 13:
-		panic("MMM01 mapper requested. Not implemented!")
+		return nil, fmt.Errorf("MMM01 mapper requested. Not implemented!")
 	case 15, 16, 17, 18, 19:
-		return &mbc3{}
+		return &mbc3{}, nil
 	case 25, 26, 27, 28, 29, 30:
-		return &mbc5{}
+		return &mbc5{}, nil
 	default:
-		panic(fmt.Sprintf("makeMBC: unknown cart type %v", cartInfo.CartridgeType))
+		return nil, fmt.Errorf("unknown cart type %v", cartInfo.CartridgeType)
 	}
 }
 
@@ -155,7 +155,7 @@ func (mbc *nullMBC) Read(mem *mem, addr uint16) byte {
 		}
 		return 0xff
 	default:
-		panic(fmt.Sprintf("nullMBC: not implemented: read at %x\n", addr))
+		return mem.fault("nullMBC: not implemented: read at %x", addr)
 	}
 }
 func (mbc *nullMBC) Write(mem *mem, addr uint16, val byte) {
@@ -192,7 +192,7 @@ func (mbc *mbc1) Read(mem *mem, addr uint16) byte {
 	case addr >= 0x4000 && addr < 0x8000:
 		localAddr := uint(addr-0x4000) + mbc.ROMBankOffset()
 		if localAddr >= uint(len(mem.cart)) {
-			panic(fmt.Sprintf("mbc1: bad rom local addr: 0x%06x, bank number: %d\r\n", localAddr, mbc.ROMBankNumber))
+			return mem.fault("mbc1: bad rom local addr: 0x%06x, bank number: %d", localAddr, mbc.ROMBankNumber)
 		}
 		return mem.cart[localAddr]
 	case addr >= 0xa000 && addr < 0xc000:
@@ -202,7 +202,7 @@ func (mbc *mbc1) Read(mem *mem, addr uint16) byte {
 		}
 		return 0xff
 	default:
-		panic(fmt.Sprintf("mbc1: not implemented: read at %x\n", addr))
+		return mem.fault("mbc1: not implemented: read at %x", addr)
 	}
 }
 
@@ -247,7 +247,7 @@ func (mbc *mbc1) Write(mem *mem, addr uint16, val byte) {
 			mem.CartRAM[localAddr] = val
 		}
 	default:
-		panic(fmt.Sprintf("mbc1: not implemented: write at %x\n", addr))
+		mem.fault("mbc1: not implemented: write at %x", addr)
 	}
 }
 
@@ -280,7 +280,7 @@ func (mbc *mbc2) Read(mem *mem, addr uint16) byte {
 	case addr >= 0x4000 && addr < 0x8000:
 		localAddr := uint(addr-0x4000) + mbc.ROMBankOffset()
 		if localAddr >= uint(len(mem.cart)) {
-			panic(fmt.Sprintf("mbc2: bad rom local addr: 0x%06x, bank number: %d\r\n", localAddr, mbc.ROMBankNumber))
+			return mem.fault("mbc2: bad rom local addr: 0x%06x, bank number: %d", localAddr, mbc.ROMBankNumber)
 		}
 		return mem.cart[localAddr]
 	case addr >= 0xa000 && addr < 0xc000:
@@ -291,7 +291,7 @@ func (mbc *mbc2) Read(mem *mem, addr uint16) byte {
 		}
 		return 0xff
 	default:
-		panic(fmt.Sprintf("mbc2: not implemented: read at %x\n", addr))
+		return mem.fault("mbc2: not implemented: read at %x", addr)
 	}
 }
 
@@ -324,7 +324,7 @@ func (mbc *mbc2) Write(mem *mem, addr uint16, val byte) {
 			mem.CartRAM[localAddr] = val & 0x0f
 		}
 	default:
-		panic(fmt.Sprintf("mbc2: not implemented: write at %x\n", addr))
+		mem.fault("mbc2: not implemented: write at %x", addr)
 	}
 }
 
@@ -416,7 +416,7 @@ func (mbc *mbc3) Read(mem *mem, addr uint16) byte {
 	case addr >= 0x4000 && addr < 0x8000:
 		localAddr := uint(addr-0x4000) + mbc.ROMBankOffset()
 		if localAddr >= uint(len(mem.cart)) {
-			panic(fmt.Sprintf("mbc3: bad rom local addr: 0x%06x, bank number: %d\r\n", localAddr, mbc.ROMBankNumber))
+			return mem.fault("mbc3: bad rom local addr: 0x%06x, bank number: %d", localAddr, mbc.ROMBankNumber)
 		}
 		return mem.cart[localAddr]
 	case addr >= 0xa000 && addr < 0xc000:
@@ -440,7 +440,7 @@ func (mbc *mbc3) Read(mem *mem, addr uint16) byte {
 		}
 		// might need a default of return 0xff here
 	}
-	panic(fmt.Sprintf("mbc3: not implemented: read at %x\n", addr))
+	return mem.fault("mbc3: not implemented: read at %x", addr)
 }
 
 func (mbc *mbc3) Write(mem *mem, addr uint16, val byte) {
@@ -502,7 +502,7 @@ func (mbc *mbc3) Write(mem *mem, addr uint16, val byte) {
 			// nop
 		}
 	default:
-		panic(fmt.Sprintf("mbc3: not implemented: write at %x\n", addr))
+		mem.fault("mbc3: not implemented: write at %x", addr)
 	}
 }
 
@@ -537,7 +537,7 @@ func (mbc *mbc5) Read(mem *mem, addr uint16) byte {
 	case addr >= 0x4000 && addr < 0x8000:
 		localAddr := uint(addr-0x4000) + mbc.ROMBankOffset()
 		if localAddr >= uint(len(mem.cart)) {
-			panic(fmt.Sprintf("mbc5: bad rom local addr: 0x%06x, bank number: %d\r\n", localAddr, mbc.ROMBankNumber))
+			return mem.fault("mbc5: bad rom local addr: 0x%06x, bank number: %d", localAddr, mbc.ROMBankNumber)
 		}
 		return mem.cart[localAddr]
 	case addr >= 0xa000 && addr < 0xc000:
@@ -547,7 +547,7 @@ func (mbc *mbc5) Read(mem *mem, addr uint16) byte {
 		}
 		return 0xff
 	default:
-		panic(fmt.Sprintf("mbc5: not implemented: read at %x\n", addr))
+		return mem.fault("mbc5: not implemented: read at %x", addr)
 	}
 }
 
@@ -572,7 +572,7 @@ func (mbc *mbc5) Write(mem *mem, addr uint16, val byte) {
 			mem.CartRAM[localAddr] = val
 		}
 	default:
-		panic(fmt.Sprintf("mbc5: not implemented: write at %x\n", addr))
+		mem.fault("mbc5: not implemented: write at %x", addr)
 	}
 }
 
@@ -603,13 +603,13 @@ func (mbc *gbsMBC) Read(mem *mem, addr uint16) byte {
 	case addr >= 0x4000 && addr < 0x8000:
 		localAddr := uint(addr-0x4000) + mbc.ROMBankOffset()
 		if localAddr >= uint(len(mem.cart)) {
-			panic(fmt.Sprintf("gbsMBC: bad rom local addr: 0x%06x, bank number: %d\r\n", localAddr, mbc.ROMBankNumber))
+			return mem.fault("gbsMBC: bad rom local addr: 0x%06x, bank number: %d", localAddr, mbc.ROMBankNumber)
 		}
 		return mem.cart[localAddr]
 	case addr >= 0xa000 && addr < 0xc000:
 		return mem.CartRAM[addr-0xa000]
 	default:
-		panic(fmt.Sprintf("gbsMBC: not implemented: read at %x\n", addr))
+		return mem.fault("gbsMBC: not implemented: read at %x", addr)
 	}
 }
 
@@ -627,7 +627,7 @@ func (mbc *gbsMBC) Write(mem *mem, addr uint16, val byte) {
 		localAddr := uint(addr - 0xa000)
 		mem.CartRAM[localAddr] = val
 	default:
-		panic(fmt.Sprintf("gbsMBC: not implemented: write at %x\n", addr))
+		mem.fault("gbsMBC: not implemented: write at %x", addr)
 	}
 }
 
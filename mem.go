@@ -4,7 +4,8 @@ import "fmt"
 
 type mem struct {
 	// not marshalled in snapshot
-	cart []byte
+	cart     []byte
+	faultErr error
 
 	// everything else marshalled
 
@@ -15,13 +16,14 @@ type mem struct {
 	mbc                   mbc
 
 	// cgb dma
-	DMASource     uint16
-	DMASourceReg  uint16
-	DMADest       uint16
-	DMADestReg    uint16
-	DMALength     uint16
-	DMAHblankMode bool
-	DMAInProgress bool
+	DMASource        uint16
+	DMASourceReg     uint16
+	DMADest          uint16
+	DMADestReg       uint16
+	DMALength        uint16
+	DMAHblankMode    bool
+	DMAInProgress    bool
+	DMAHblankPending bool // set at hblank start, run before the next non-halted instruction
 }
 
 func (mem *mem) mbcRead(addr uint16) byte {
@@ -31,6 +33,15 @@ func (mem *mem) mbcWrite(addr uint16, val byte) {
 	mem.mbc.Write(mem, addr, val)
 }
 
+// fault records an error hit mid-access for the cpu to pick
+// up at the end of the step. Returns 0xff, like an open bus.
+func (mem *mem) fault(format string, args ...interface{}) byte {
+	if mem.faultErr == nil {
+		mem.faultErr = fmt.Errorf(format, args...)
+	}
+	return 0xff
+}
+
 func (cs *cpuState) writeDMASourceHigh(val byte) {
 	cs.Mem.DMASourceReg = (cs.Mem.DMASourceReg &^ 0xff00) | (uint16(val) << 8)
 }
@@ -60,18 +71,25 @@ func (cs *cpuState) readDMADestLow() byte {
 	return byte(cs.Mem.DMADestReg)
 }
 
+// General purpose DMA stalls the cpu until it's done. HBlank DMA moves
+// one 0x10 byte block per HBlank, stalling the cpu for just that block,
+// and waits out any HALT. Each block takes 32 dots in either speed mode.
 func (cs *cpuState) writeDMAControlReg(val byte) {
-	cs.Mem.DMALength = (uint16(val&0x7f) + 1) << 4
-	cs.Mem.DMAHblankMode = val&0x80 != 0
 	if cs.Mem.DMAInProgress && (val&0x80 == 0) {
-		cs.Mem.DMAHblankMode = false
+		// cancelled, remaining length is still readable
 		cs.Mem.DMAInProgress = false
+		cs.Mem.DMAHblankPending = false
 		return
 	}
+	cs.Mem.DMALength = (uint16(val&0x7f) + 1) << 4
+	cs.Mem.DMAHblankMode = val&0x80 != 0
 	cs.Mem.DMAInProgress = true
 	cs.Mem.DMASource = (cs.Mem.DMASourceReg & 0xfff0)
 	cs.Mem.DMADest = (cs.Mem.DMADestReg & 0x1ff0) | 0x8000
-	if !cs.Mem.DMAHblankMode {
+	if cs.Mem.DMAHblankMode {
+		// with the lcd off (or already in hblank) the first block goes right away
+		cs.Mem.DMAHblankPending = !cs.LCD.DisplayOn || (cs.LCD.InHBlank && !cs.LCD.InVBlank)
+	} else {
 		for cs.Mem.DMAInProgress {
 			cs.runDMACycle()
 		}
@@ -86,9 +104,10 @@ func (cs *cpuState) readDMAControlReg() byte {
 }
 
 func (cs *cpuState) runDMACycle() {
-	cs.write(cs.Mem.DMADest, cs.read(cs.Mem.DMASource))
-	cs.write(cs.Mem.DMADest+1, cs.read(cs.Mem.DMASource+1))
-	if cs.CGBMode {
+	cs.writeNoHooks(cs.Mem.DMADest, cs.readNoHooks(cs.Mem.DMASource))
+	cs.writeNoHooks(cs.Mem.DMADest+1, cs.readNoHooks(cs.Mem.DMASource+1))
+	// 2 bytes per M-cycle at normal speed, 1 at double speed
+	if cs.FastMode {
 		cs.runCycles(8)
 	} else {
 		cs.runCycles(4)
@@ -100,15 +119,28 @@ func (cs *cpuState) runDMACycle() {
 		cs.Mem.DMAInProgress = false
 	}
 }
-func (cs *cpuState) runHblankDMA() {
+func (cs *cpuState) startHblankDMA() {
 	if cs.Mem.DMAInProgress && cs.Mem.DMAHblankMode {
-		for i := 0; cs.Mem.DMAInProgress && i < 8; i++ {
-			cs.runDMACycle()
-		}
+		cs.Mem.DMAHblankPending = true
+	}
+}
+func (cs *cpuState) runHblankDMA() {
+	cs.Mem.DMAHblankPending = false
+	for i := 0; cs.Mem.DMAInProgress && i < 8; i++ {
+		cs.runDMACycle()
 	}
 }
 
 func (cs *cpuState) read(addr uint16) byte {
+	val := cs.readNoHooks(addr)
+	if cs.hooks != nil {
+		cs.runMemHooks(cs.hooks.readHooks, addr, val)
+	}
+	return val
+}
+
+// for DMA and other accesses that aren't the cpu's, which hooks don't see
+func (cs *cpuState) readNoHooks(addr uint16) byte {
 	var val byte
 	switch {
 
@@ -129,7 +161,11 @@ func (cs *cpuState) read(addr uint16) byte {
 		val = cs.Mem.InternalRAM[ramAddr]
 
 	case addr >= 0xfe00 && addr < 0xfea0:
-		val = cs.LCD.readOAM(addr - 0xfe00)
+		if cs.OAMDMAActive {
+			val = 0xff
+		} else {
+			val = cs.LCD.readOAM(addr - 0xfe00)
+		}
 
 	case addr >= 0xfea0 && addr < 0xff00:
 		val = 0xff // (empty mem, but can be more complicated, see TCAGBD)
@@ -335,7 +371,7 @@ func (cs *cpuState) read(addr uint16) byte {
 		val = cs.readInterruptEnableReg()
 
 	default:
-		cs.stepErr(fmt.Sprintf("not implemented: read at %x\n", addr))
+		cs.stepErr(fmt.Sprintf("not implemented: read at %x", addr))
 	}
 	return val
 }
@@ -347,6 +383,13 @@ func (cs *cpuState) read16(addr uint16) uint16 {
 }
 
 func (cs *cpuState) write(addr uint16, val byte) {
+	cs.writeNoHooks(addr, val)
+	if cs.hooks != nil {
+		cs.runMemHooks(cs.hooks.writeHooks, addr, val)
+	}
+}
+
+func (cs *cpuState) writeNoHooks(addr uint16, val byte) {
 	switch {
 
 	case addr < 0x8000:
@@ -365,7 +408,9 @@ func (cs *cpuState) write(addr uint16, val byte) {
 		}
 		cs.Mem.InternalRAM[ramAddr] = val
 	case addr >= 0xfe00 && addr < 0xfea0:
-		cs.LCD.writeOAM(addr-0xfe00, val)
+		if !cs.OAMDMAActive {
+			cs.LCD.writeOAM(addr-0xfe00, val)
+		}
 	case addr >= 0xfea0 && addr < 0xff00:
 		// empty, nop (can be more complicated, see TCAGBD)
 
@@ -470,9 +515,7 @@ func (cs *cpuState) write(addr uint16, val byte) {
 	case addr == 0xff45:
 		cs.LCD.writeLycReg(val)
 	case addr == 0xff46:
-		cs.OAMDMAIndex = 0
-		cs.OAMDMAActive = true
-		cs.OAMDMASource = uint16(val) << 8
+		cs.writeOAMDMAReg(val)
 	case addr == 0xff47:
 		cs.LCD.writeBackgroundPaletteReg(val)
 	case addr == 0xff48:
@@ -568,7 +611,7 @@ func (cs *cpuState) write(addr uint16, val byte) {
 	case addr == 0xffff:
 		cs.writeInterruptEnableReg(val)
 	default:
-		cs.stepErr(fmt.Sprintf("not implemented: write(0x%04x, %v)\n", addr, val))
+		cs.stepErr(fmt.Sprintf("not implemented: write(0x%04x, %v)", addr, val))
 	}
 }
 
@@ -0,0 +1,69 @@
+package dmgo
+
+// The DMG's OAM corruption bug. During mode 2 the PPU reads OAM a row
+// (8 bytes, two sprites) at a time, and if the CPU puts an address in
+// 0xfe00-0xfeff on the bus at the same moment (a read, a write, or a
+// 16-bit inc/dec through the IDU) the row being read gets mangled using
+// the row before it. The CGB doesn't have the bug.
+
+const (
+	oamBugWrite = iota // writes and plain 16-bit inc/dec
+	oamBugRead
+	oamBugReadIncDec // a read on the same cycle as an inc/dec, e.g. ld a, (hl++) or pop
+)
+
+func (cs *cpuState) triggerOAMBug(addr uint16, kind int) {
+	if cs.CGBMode || addr < 0xfe00 || addr > 0xfeff {
+		return
+	}
+	if !cs.LCD.DisplayOn || !cs.LCD.AccessingOAM {
+		return
+	}
+	// row 0 is never corrupted, and mode 2 starts a
+	// cycle into the line, so this lands in 1-19
+	row := int(cs.LCD.CyclesSinceLYInc / 4)
+	if row < 1 || row >= 20 {
+		return
+	}
+	cs.LCD.corruptOAMRow(row, kind)
+}
+
+func (lcd *lcd) oamWord(row, word int) uint16 {
+	addr := row*8 + word*2
+	return uint16(lcd.OAM[addr]) | uint16(lcd.OAM[addr+1])<<8
+}
+func (lcd *lcd) setOAMWord(row, word int, val uint16) {
+	addr := row*8 + word*2
+	lcd.OAM[addr] = byte(val)
+	lcd.OAM[addr+1] = byte(val >> 8)
+}
+func (lcd *lcd) copyOAMRow(dstRow, srcRow int) {
+	copy(lcd.OAM[dstRow*8:dstRow*8+8], lcd.OAM[srcRow*8:srcRow*8+8])
+}
+
+func (lcd *lcd) corruptOAMRow(row int, kind int) {
+	if kind == oamBugReadIncDec {
+		if row >= 4 && row < 19 {
+			a := lcd.oamWord(row-2, 0)
+			b := lcd.oamWord(row-1, 0)
+			c := lcd.oamWord(row, 0)
+			d := lcd.oamWord(row-2, 2)
+			lcd.setOAMWord(row-1, 0, (b&(a|c|d))|(a&c&d))
+			lcd.copyOAMRow(row, row-1)
+			lcd.copyOAMRow(row-2, row-1)
+		}
+		kind = oamBugRead
+	}
+
+	a := lcd.oamWord(row, 0)
+	b := lcd.oamWord(row-1, 0)
+	c := lcd.oamWord(row-1, 2)
+	var first uint16
+	if kind == oamBugRead {
+		first = b | (a & c)
+	} else {
+		first = ((a ^ c) & (b ^ c)) ^ c
+	}
+	lcd.copyOAMRow(row, row-1)
+	lcd.setOAMWord(row, 0, first)
+}
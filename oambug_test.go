@@ -0,0 +1,85 @@
+package dmgo
+
+import (
+	"bytes"
+	"testing"
+)
+
+// an OAM pattern where every corruption formula changes something
+func oamBugTestPattern() [160]byte {
+	var oam [160]byte
+	for i := range oam {
+		oam[i] = byte(i*i*13 + i*5 + 1)
+	}
+	return oam
+}
+
+func TestOAMBugPatterns(t *testing.T) {
+	// rows that end up different from oamBugTestPattern
+	writeRows := map[int][]byte{5: {0x81, 0x3b, 0x5f, 0xe5, 0x85, 0x3f, 0x13, 0x01}}
+	readRows := map[int][]byte{5: {0xa1, 0xfb, 0x5f, 0xe5, 0x85, 0x3f, 0x13, 0x01}}
+	incDecRow := []byte{0xa9, 0x73, 0x5f, 0xe5, 0x85, 0x3f, 0x13, 0x01}
+	readIncDecRows := map[int][]byte{3: incDecRow, 4: incDecRow, 5: incDecRow}
+	popRows := map[int][]byte{3: incDecRow, 4: incDecRow, 5: incDecRow, 6: incDecRow}
+
+	for _, tc := range []struct {
+		name   string
+		opcode byte
+		setup  func(cs *cpuState)
+		want   map[int][]byte
+	}{
+		{"inc hl", 0x23, func(cs *cpuState) { cs.setHL(0xfe10) }, writeRows},
+		{"dec hl", 0x2b, func(cs *cpuState) { cs.setHL(0xfe10) }, writeRows},
+		{"inc hl outside OAM", 0x23, func(cs *cpuState) { cs.setHL(0xff10) }, nil},
+		{"ld a, (hl)", 0x7e, func(cs *cpuState) { cs.setHL(0xfe10) }, readRows},
+		{"ld (hl), a", 0x77, func(cs *cpuState) { cs.setHL(0xfe10) }, writeRows},
+		{"ld a, (hl++)", 0x2a, func(cs *cpuState) { cs.setHL(0xfe10) }, readIncDecRows},
+		{"push bc", 0xc5, func(cs *cpuState) { cs.SP = 0xfe20 }, writeRows},
+		{"pop bc", 0xc1, func(cs *cpuState) { cs.SP = 0xfe10 }, popRows},
+	} {
+		cs, err := newState(loopROM(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// each opcode's first access comes 4 dots in, on row 5
+		for cs.LCD.LYReg != 10 || cs.LCD.CyclesSinceLYInc != 16 {
+			cs.runCycles(1)
+		}
+		if !cs.LCD.AccessingOAM {
+			t.Fatal("not in mode 2")
+		}
+		cs.LCD.OAM = oamBugTestPattern()
+		cs.write(0xc000, tc.opcode)
+		cs.PC = 0xc000
+		tc.setup(cs)
+		cs.stepOpcode()
+
+		want := oamBugTestPattern()
+		for row, vals := range tc.want {
+			copy(want[row*8:], vals)
+		}
+		for row := 0; row < 20; row++ {
+			if got := cs.LCD.OAM[row*8 : row*8+8]; !bytes.Equal(got, want[row*8:row*8+8]) {
+				t.Errorf("%s: OAM row %d is % x, want % x", tc.name, row, got, want[row*8:row*8+8])
+			}
+		}
+	}
+}
+
+func TestOAMBugNotOnCGB(t *testing.T) {
+	cs, err := newState(cgbTestROM(0x18, 0xfe), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cs.LCD.LYReg != 10 || cs.LCD.CyclesSinceLYInc != 16 {
+		cs.runCycles(1)
+	}
+	cs.LCD.OAM = oamBugTestPattern()
+	cs.write(0xc000, 0x23) // inc hl
+	cs.PC = 0xc000
+	cs.setHL(0xfe10)
+	cs.stepOpcode()
+	if cs.LCD.OAM != oamBugTestPattern() {
+		t.Error("OAM corrupted on CGB")
+	}
+}
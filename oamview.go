@@ -0,0 +1,119 @@
+package dmgo
+
+import (
+	"image"
+)
+
+// SpriteInfo is one OAM entry, decoded, from InspectOAM
+type SpriteInfo struct {
+	Index int
+
+	// raw OAM bytes
+	RawY, RawX, Tile, Flags byte
+
+	// top left corner in screen coords (RawX-8, RawY-16)
+	X, Y int
+	// 8 or 16, from LCDC
+	Height int
+
+	BehindBG bool
+	XFlip    bool
+	YFlip    bool
+	// OBP0 or OBP1, DMG only
+	DMGPalette int
+	// CGB only
+	CGBPalette int
+	CGBBank    int
+
+	// Lines is every scanline (0-143) the sprite is on, and
+	// DroppedLines the ones where it's past the first 10 sprites
+	// found, so real hardware doesn't draw it there.
+	Lines        []int
+	DroppedLines []int
+
+	// Visible is if any of the sprite gets drawn: it has to be on some
+	// line without being dropped, and not be off the left or right edge
+	Visible bool
+}
+
+// InspectOAM decodes all 40 OAM entries as OAM and LCDC are right now
+func (cs *cpuState) InspectOAM() []SpriteInfo {
+	return cs.LCD.inspectOAM()
+}
+
+func (lcd *lcd) inspectOAM() []SpriteInfo {
+	height := lcd.spriteHeight()
+	infos := make([]SpriteInfo, 40)
+	for i := range infos {
+		e := lcd.oamEntryAt(i, height)
+		infos[i] = SpriteInfo{
+			Index:      i,
+			RawY:       lcd.OAM[i*4],
+			RawX:       lcd.OAM[i*4+1],
+			Tile:       e.TileNum,
+			Flags:      e.FlagsByte,
+			X:          int(e.X),
+			Y:          int(e.Y),
+			Height:     height,
+			BehindBG:   e.behindBG(),
+			XFlip:      e.xFlip(),
+			YFlip:      e.yFlip(),
+			CGBPalette: int(e.cgbPalNumber()),
+		}
+		if e.palSelector() {
+			infos[i].DMGPalette = 1
+		}
+		if e.cgbUseHighBank() {
+			infos[i].CGBBank = 1
+		}
+	}
+
+	// same search as parseOAMForScanline
+	for line := 0; line < 144; line++ {
+		found := 0
+		for i := range infos {
+			info := &infos[i]
+			if !yInSprite(byte(line), int16(info.Y), height) {
+				continue
+			}
+			info.Lines = append(info.Lines, line)
+			if found >= 10 {
+				info.DroppedLines = append(info.DroppedLines, line)
+			}
+			found++
+		}
+	}
+	for i := range infos {
+		info := &infos[i]
+		info.Visible = len(info.Lines) > len(info.DroppedLines) && info.X > -8 && info.X < 160
+	}
+	return infos
+}
+
+// SpriteSheetImage draws all 40 sprites as they'd look on screen (own
+// palette, flips, and 8x16 mode applied), in OAM order, 8 to a row.
+// Color 0 is left transparent.
+func (cs *cpuState) SpriteSheetImage() *image.RGBA {
+	return cs.LCD.spriteSheetImage()
+}
+
+func (lcd *lcd) spriteSheetImage() *image.RGBA {
+	height := lcd.spriteHeight()
+	img := image.NewRGBA(image.Rect(0, 0, 8*8, 5*height))
+	for i := 0; i < 40; i++ {
+		e := lcd.oamEntryAt(i, height)
+		cellX, cellY := (i%8)*8, (i/8)*height
+		for row := 0; row < height; row++ {
+			lo, hi := lcd.spriteRowData(&e, byte(row))
+			for col := 0; col < 8; col++ {
+				pix := tileRowPixel(lo, hi, byte(col), e.xFlip())
+				if pix == 0 {
+					continue
+				}
+				r, g, b := lcd.applySpritePalettes(&e, pix)
+				setImagePixel(img, cellX+col, cellY+row, r, g, b)
+			}
+		}
+	}
+	return img
+}
@@ -152,13 +152,20 @@ func cFlagSbc(val, subtrahend, fReg uint8) uint16 {
 
 func (cs *cpuState) pushOp16(val uint16) {
 	cs.runCycles(4)
-	// Can't use cpuWrite16 b/c push goes in opposite order.
-	cs.cpuWrite(cs.SP-1, byte(val>>8))
-	cs.cpuWrite(cs.SP-2, byte(val))
+	cs.triggerOAMBug(cs.SP, oamBugWrite)
+	// Can't use cpuWrite16 b/c push goes in opposite order. And
+	// not cpuWrite either, the corruption above is the only one
+	// a push makes (see the Pan Docs table).
+	cs.runCycles(4)
+	cs.write(cs.SP-1, byte(val>>8))
+	cs.runCycles(4)
+	cs.write(cs.SP-2, byte(val))
 	cs.SP -= 2
 }
 func (cs *cpuState) popOp16(setFn func(val uint16)) {
-	setFn(cs.cpuRead16(cs.SP))
+	lsb := cs.cpuReadIncDec(cs.SP)
+	msb := cs.cpuReadIncDec(cs.SP + 1)
+	setFn((uint16(msb) << 8) | uint16(lsb))
 	cs.SP += 2
 }
 
@@ -260,7 +267,7 @@ func (cs *cpuState) DebugStatusLine() string {
 
 	return fmt.Sprintf("Step:%08d, ", cs.Steps) +
 		fmt.Sprintf("Cycles:%08d, ", cs.Cycles) +
-		fmt.Sprintf("(*PC)[0:2]:%02x%02x%02x, ", cs.read(cs.PC), cs.read(cs.PC+1), cs.read(cs.PC+2)) +
+		fmt.Sprintf("(*PC)[0:2]:%02x%02x%02x, ", cs.readNoHooks(cs.PC), cs.readNoHooks(cs.PC+1), cs.readNoHooks(cs.PC+2)) +
 		fmt.Sprintf("(*SP):%04x, ", cs.read16(cs.SP)) +
 		fmt.Sprintf("[PC:%04x ", cs.PC) +
 		fmt.Sprintf("SP:%04x ", cs.SP) +
@@ -357,11 +364,28 @@ var simpleOpFnTable = []func(*cpuState, byte){
 
 func (cs *cpuState) cpuRead(addr uint16) byte {
 	cs.runCycles(4)
-	return cs.read(addr)
+	cs.triggerOAMBug(addr, oamBugRead)
+	return cs.busRead(addr)
+}
+
+// for reads that happen alongside a 16-bit inc/dec of the addr
+func (cs *cpuState) cpuReadIncDec(addr uint16) byte {
+	cs.runCycles(4)
+	cs.triggerOAMBug(addr, oamBugReadIncDec)
+	return cs.busRead(addr)
+}
+
+func (cs *cpuState) busRead(addr uint16) byte {
+	val := cs.read(addr)
+	if cs.oamDMABusConflict(addr) {
+		val = cs.OAMDMABusByte
+	}
+	return val
 }
 
 func (cs *cpuState) cpuWrite(addr uint16, val byte) {
 	cs.runCycles(4)
+	cs.triggerOAMBug(addr, oamBugWrite)
 	cs.write(addr, val)
 }
 
@@ -392,7 +416,11 @@ func (cs *cpuState) cpuReadAndIncPC16() uint16 {
 
 func (cs *cpuState) stepOpcode() {
 
-	opcode := cs.read(cs.PC) // no runCycles, because we're acting like this was prefetched
+	if cs.hooks != nil {
+		cs.runExecHooks(cs.PC)
+	}
+
+	opcode := cs.busRead(cs.PC) // no runCycles, because we're acting like this was prefetched
 	cs.PC++
 
 	// simple cases [ ld R, R_OR_(HL) or ALU_OP R_OR_(HL) ]
@@ -415,6 +443,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.cpuWrite(cs.getBC(), cs.A)
 	case 0x03: // inc bc
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getBC(), oamBugWrite)
 		cs.setBC(cs.getBC() + 1)
 	case 0x04: // inc b
 		cs.incOpReg(&cs.B)
@@ -434,6 +463,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.A = cs.cpuRead(cs.getBC())
 	case 0x0b: // dec bc
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getBC(), oamBugWrite)
 		cs.setBC(cs.getBC() - 1)
 	case 0x0c: // inc c
 		cs.incOpReg(&cs.C)
@@ -452,6 +482,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.cpuWrite(cs.getDE(), cs.A)
 	case 0x13: // inc de
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getDE(), oamBugWrite)
 		cs.setDE(cs.getDE() + 1)
 	case 0x14: // inc d
 		cs.incOpReg(&cs.D)
@@ -471,6 +502,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.A = cs.cpuRead(cs.getDE())
 	case 0x1b: // dec de
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getDE(), oamBugWrite)
 		cs.setDE(cs.getDE() - 1)
 	case 0x1c: // inc e
 		cs.incOpReg(&cs.E)
@@ -490,6 +522,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.setHL(cs.getHL() + 1)
 	case 0x23: // inc hl
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getHL(), oamBugWrite)
 		cs.setHL(cs.getHL() + 1)
 	case 0x24: // inc h
 		cs.incOpReg(&cs.H)
@@ -506,10 +539,11 @@ func (cs *cpuState) stepOpcode() {
 		v1, v2 := cs.getHL(), cs.getHL()
 		cs.setOp16(4, cs.setHL, v1+v2, (0x2000 | hFlagAdd16(v1, v2) | cFlagAdd16(v1, v2)))
 	case 0x2a: // ld a, (hl++)
-		cs.A = cs.cpuRead(cs.getHL())
+		cs.A = cs.cpuReadIncDec(cs.getHL())
 		cs.setHL(cs.getHL() + 1)
 	case 0x2b: // dec hl
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.getHL(), oamBugWrite)
 		cs.setHL(cs.getHL() - 1)
 	case 0x2c: // inc l
 		cs.incOpReg(&cs.L)
@@ -529,6 +563,7 @@ func (cs *cpuState) stepOpcode() {
 		cs.setHL(cs.getHL() - 1)
 	case 0x33: // inc sp
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.SP, oamBugWrite)
 		cs.SP++
 	case 0x34: // inc (hl)
 		cs.incOpHL()
@@ -545,10 +580,11 @@ func (cs *cpuState) stepOpcode() {
 		v1, v2 := cs.getHL(), cs.SP
 		cs.setOp16(4, cs.setHL, v1+v2, (0x2000 | hFlagAdd16(v1, v2) | cFlagAdd16(v1, v2)))
 	case 0x3a: // ld a, (hl--)
-		cs.A = cs.cpuRead(cs.getHL())
+		cs.A = cs.cpuReadIncDec(cs.getHL())
 		cs.setHL(cs.getHL() - 1)
 	case 0x3b: // dec sp
 		cs.runCycles(4)
+		cs.triggerOAMBug(cs.SP, oamBugWrite)
 		cs.SP--
 	case 0x3c: // inc a
 		cs.incOpReg(&cs.A)
@@ -725,13 +761,17 @@ func (cs *cpuState) stepOpcode() {
 		cs.callOp(0x0038)
 
 	default:
-		cs.stepErr(fmt.Sprintf("Unknown Opcode: 0x%02x\r\n", opcode))
+		cs.stepErr(fmt.Sprintf("Unknown Opcode: 0x%02x", opcode))
 	}
 
 	cs.runCycles(4) // to cover the last execute step / next prefetch of opcodes
 }
 
 func (cs *cpuState) illegalOpcode(opcode uint8) {
+	if cs.lockupOnIllegalOpcode {
+		cs.InLockup = true
+		return
+	}
 	cs.stepErr(fmt.Sprintf("illegal opcode %02x", opcode))
 }
 
@@ -905,8 +945,13 @@ func (cs *cpuState) bitSetOp(opcode byte, bitNum uint8) {
 	}
 }
 
+// stepErr stops emulation, see Err()
 func (cs *cpuState) stepErr(msg string) {
-	fmt.Println(msg)
-	fmt.Println(cs.DebugStatusLine())
-	panic("stepErr()")
+	if cs.faultErr != nil {
+		return
+	}
+	cs.faultErr = fmt.Errorf("%s\n%s", msg, cs.DebugStatusLine())
+	if cs.devMode {
+		fmt.Println(cs.faultErr)
+	}
 }
@@ -0,0 +1,190 @@
+package dmgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RGB is a 24-bit display color
+type RGB struct {
+	R, G, B byte
+}
+
+// DMGPalette maps the 4 DMG shades (after BGP/OBP0/OBP1 are applied)
+// to display colors, lightest shade first. BG covers the window too.
+// CGB games ignore it and use their own palette RAM.
+type DMGPalette struct {
+	BG   [4]RGB
+	OBJ0 [4]RGB
+	OBJ1 [4]RGB
+}
+
+func uniformDMGPalette(colors [4]RGB) DMGPalette {
+	return DMGPalette{BG: colors, OBJ0: colors, OBJ1: colors}
+}
+
+// DMGPalettePresets are the built-in palettes, by name. For the CGB
+// boot rom's per-game colors, see CartInfo.CGBColorizationPalette.
+var DMGPalettePresets = map[string]DMGPalette{
+	// plain greyscale, the default
+	"grey": uniformDMGPalette([4]RGB{{0xff, 0xff, 0xff}, {0xaa, 0xaa, 0xaa}, {0x55, 0x55, 0x55}, {0x00, 0x00, 0x00}}),
+	// the original pea-soup green
+	"green": uniformDMGPalette([4]RGB{{0x9b, 0xbc, 0x0f}, {0x8b, 0xac, 0x0f}, {0x30, 0x62, 0x30}, {0x0f, 0x38, 0x0f}}),
+	// GB Pocket's black-and-white-ish screen
+	"pocket": uniformDMGPalette([4]RGB{{0xc4, 0xcf, 0xa1}, {0x8b, 0x95, 0x6d}, {0x4d, 0x53, 0x3c}, {0x1f, 0x1f, 0x1f}}),
+	// GB Light's backlit blue-green
+	"light": uniformDMGPalette([4]RGB{{0x00, 0xb5, 0x81}, {0x00, 0x9a, 0x71}, {0x00, 0x69, 0x4a}, {0x00, 0x4f, 0x3b}}),
+}
+
+// DefaultDMGPalette is what DMG games are shown with unless told otherwise
+var DefaultDMGPalette = DMGPalettePresets["grey"]
+
+// DMGPalettePresetNames lists the preset names, sorted
+func DMGPalettePresetNames() []string {
+	names := []string{}
+	for name := range DMGPalettePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetDMGPalettePreset looks up a preset by name (case-insensitive)
+func GetDMGPalettePreset(name string) (DMGPalette, error) {
+	if pal, ok := DMGPalettePresets[strings.ToLower(name)]; ok {
+		return pal, nil
+	}
+	return DMGPalette{}, fmt.Errorf("unknown palette %q, choices are: %s", name, strings.Join(DMGPalettePresetNames(), ", "))
+}
+
+// CGBColorizationPalette returns the palette the CGB boot rom picks
+// when running this (DMG-only) game: Nintendo-published games are
+// looked up by the sum of their title bytes, with the 4th letter of the
+// title breaking ties, and everything else gets the default green/red.
+func (ci *CartInfo) CGBColorizationPalette() DMGPalette {
+	combo := colorizationCombos[0]
+	if ci.isNintendoLicensed() {
+		title := []byte(ci.Title + ci.ManufacturerCode)
+		checksum := byte(0)
+		for _, b := range title {
+			checksum += b
+		}
+		fourthLetter := byte(0)
+		if len(title) > 3 {
+			fourthLetter = title[3]
+		}
+		for i, sum := range colorizationTitleChecksums {
+			if sum != checksum {
+				continue
+			}
+			if i >= colorizationFirstDupChecksum && colorizationDupLetters[i-colorizationFirstDupChecksum] != fourthLetter {
+				continue
+			}
+			combo = colorizationCombos[colorizationComboForChecksum[i]]
+			break
+		}
+	}
+	return DMGPalette{
+		BG:   colorizationColors(combo[2]),
+		OBJ0: colorizationColors(combo[0]),
+		OBJ1: colorizationColors(combo[1]),
+	}
+}
+
+func (ci *CartInfo) isNintendoLicensed() bool {
+	if ci.OldLicenseeCode == 0x33 {
+		return ci.NewLicenseeCode == "01"
+	}
+	return ci.OldLicenseeCode == 0x01
+}
+
+// offset is in colors, and is not always palette-aligned
+func colorizationColors(offset int) [4]RGB {
+	var out [4]RGB
+	for i := range out {
+		r, g, b := cgbToRGB(colorizationPaletteColors[offset+i], ColorCorrectionRaw)
+		out[i] = RGB{r, g, b}
+	}
+	return out
+}
+
+// The tables below are the CGB boot rom's.
+
+var colorizationTitleChecksums = []byte{
+	0x88, 0x16, 0x36, 0xd1, 0xdb, 0xf2, 0x3c, 0x8c, 0x92, 0x3d, 0x5c, 0x58, 0xc9, 0x3e, 0x70, 0x1d,
+	0x59, 0x69, 0x19, 0x35, 0xa8, 0x14, 0xaa, 0x75, 0x95, 0x99, 0x34, 0x6f, 0x15, 0xff, 0x97, 0x4b,
+	0x90, 0x17, 0x10, 0x39, 0xf7, 0xf6, 0xa2, 0x49, 0x4e, 0x43, 0x68, 0xe0, 0x8b, 0xf0, 0xce, 0x0c,
+	0x29, 0xe8, 0xb7, 0x86, 0x9a, 0x52, 0x01, 0x9d, 0x71, 0x9c, 0xbd, 0x5d, 0x6d, 0x67, 0x3f, 0x6b,
+
+	// from here on, the 4th letter of the title has to match too
+	0xb3, 0x46, 0x28, 0xa5, 0xc6, 0xd3, 0x27, 0x61, 0x18, 0x66, 0x6a, 0xbf, 0x0d, 0xf4,
+	0xb3, 0x46, 0x28, 0xa5, 0xc6, 0xd3, 0x27, 0x61, 0x18, 0x66, 0x6a, 0xbf, 0x0d, 0xf4,
+	0xb3,
+}
+
+const colorizationFirstDupChecksum = 64
+
+var colorizationDupLetters = []byte("BEFAARBEKEK R-URAR INAILICE R")
+
+var colorizationComboForChecksum = []byte{
+	4, 5, 35, 34, 3, 31, 15, 10, 5, 19, 36, 7, 37, 30, 44, 21,
+	32, 31, 20, 5, 33, 13, 14, 5, 29, 5, 18, 9, 3, 2, 26, 25,
+	25, 41, 42, 26, 45, 42, 45, 36, 38, 26, 42, 30, 41, 34, 34, 5,
+	42, 6, 5, 33, 25, 42, 42, 40, 2, 16, 25, 42, 42, 5, 0, 39,
+
+	36, 22, 25, 6, 32, 12, 36, 11, 39, 18, 39, 24, 31, 50,
+	17, 46, 6, 27, 0, 47, 41, 41, 0, 0, 19, 34, 23, 18,
+	29,
+}
+
+// {obj0, obj1, bg}, as offsets into colorizationPaletteColors
+var colorizationCombos = [][3]int{
+	{4 * 4, 4 * 4, 29 * 4}, {18 * 4, 18 * 4, 18 * 4}, {20 * 4, 20 * 4, 20 * 4}, {24 * 4, 24 * 4, 24 * 4},
+	{9 * 4, 9 * 4, 9 * 4}, {0 * 4, 0 * 4, 0 * 4}, {27 * 4, 27 * 4, 27 * 4}, {5 * 4, 5 * 4, 5 * 4},
+	{12 * 4, 12 * 4, 12 * 4}, {26 * 4, 26 * 4, 26 * 4}, {16 * 4, 8 * 4, 8 * 4}, {4 * 4, 28 * 4, 28 * 4},
+	{4 * 4, 2 * 4, 2 * 4}, {3 * 4, 4 * 4, 4 * 4}, {4 * 4, 29 * 4, 29 * 4}, {28 * 4, 4 * 4, 28 * 4},
+	{2 * 4, 17 * 4, 2 * 4}, {16 * 4, 16 * 4, 8 * 4}, {4 * 4, 4 * 4, 7 * 4}, {4 * 4, 4 * 4, 18 * 4},
+	{4 * 4, 4 * 4, 20 * 4}, {19 * 4, 19 * 4, 9 * 4}, {4*4 - 1, 4*4 - 1, 11 * 4}, {17 * 4, 17 * 4, 2 * 4},
+	{4 * 4, 4 * 4, 2 * 4}, {4 * 4, 4 * 4, 3 * 4}, {28 * 4, 28 * 4, 0 * 4}, {3 * 4, 3 * 4, 0 * 4},
+	{0 * 4, 0 * 4, 1 * 4}, {18 * 4, 22 * 4, 18 * 4}, {20 * 4, 22 * 4, 20 * 4}, {24 * 4, 22 * 4, 24 * 4},
+	{16 * 4, 22 * 4, 8 * 4}, {17 * 4, 4 * 4, 13 * 4}, {28*4 - 1, 0 * 4, 14 * 4}, {28*4 - 1, 4 * 4, 15 * 4},
+	{19 * 4, 22 * 4, 9 * 4}, {16 * 4, 28 * 4, 10 * 4}, {4 * 4, 23 * 4, 28 * 4}, {17 * 4, 22 * 4, 2 * 4},
+	{4 * 4, 0 * 4, 2 * 4}, {4 * 4, 28 * 4, 3 * 4}, {28 * 4, 3 * 4, 0 * 4}, {3 * 4, 28 * 4, 4 * 4},
+	{21 * 4, 28 * 4, 4 * 4}, {3 * 4, 28 * 4, 0 * 4}, {25 * 4, 3 * 4, 28 * 4}, {0 * 4, 28 * 4, 8 * 4},
+	{4 * 4, 3 * 4, 28 * 4}, {28 * 4, 3 * 4, 6 * 4}, {4 * 4, 28 * 4, 29 * 4},
+}
+
+// CGB-style 15-bit colors, 4 to a palette
+var colorizationPaletteColors = []uint16{
+	0x7fff, 0x32bf, 0x00d0, 0x0000,
+	0x639f, 0x4279, 0x15b0, 0x04cb,
+	0x7fff, 0x6e31, 0x454a, 0x0000,
+	0x7fff, 0x1bef, 0x0200, 0x0000,
+	0x7fff, 0x421f, 0x1cf2, 0x0000,
+	0x7fff, 0x5294, 0x294a, 0x0000,
+	0x7fff, 0x03ff, 0x012f, 0x0000,
+	0x7fff, 0x03ef, 0x01d6, 0x0000,
+	0x7fff, 0x42b5, 0x3dc8, 0x0000,
+	0x7e74, 0x03ff, 0x0180, 0x0000,
+	0x67ff, 0x77ac, 0x1a13, 0x2d6b,
+	0x7ed6, 0x4bff, 0x2175, 0x0000,
+	0x53ff, 0x4a5f, 0x7e52, 0x0000,
+	0x4fff, 0x7ed2, 0x3a4c, 0x1ce0,
+	0x03ed, 0x7fff, 0x255f, 0x0000,
+	0x036a, 0x021f, 0x03ff, 0x7fff,
+	0x7fff, 0x01df, 0x0112, 0x0000,
+	0x231f, 0x035f, 0x00f2, 0x0009,
+	0x7fff, 0x03ea, 0x011f, 0x0000,
+	0x299f, 0x001a, 0x000c, 0x0000,
+	0x7fff, 0x027f, 0x001f, 0x0000,
+	0x7fff, 0x03e0, 0x0206, 0x0120,
+	0x7fff, 0x7eeb, 0x001f, 0x7c00,
+	0x7fff, 0x3fff, 0x7e00, 0x001f,
+	0x7fff, 0x03ff, 0x001f, 0x0000,
+	0x03ff, 0x001f, 0x000c, 0x0000,
+	0x7fff, 0x033f, 0x0193, 0x0000,
+	0x0000, 0x4200, 0x037f, 0x7fff,
+	0x7fff, 0x7e8c, 0x7c00, 0x0000,
+	0x7fff, 0x1bef, 0x6180, 0x0000,
+}
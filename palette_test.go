@@ -0,0 +1,131 @@
+package dmgo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDMGPalettePresets(t *testing.T) {
+	if got, want := DMGPalettePresetNames(), []string{"green", "grey", "light", "pocket"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("preset names are %v, want %v", got, want)
+	}
+	if DefaultDMGPalette != DMGPalettePresets["grey"] {
+		t.Errorf("default palette isn't grey")
+	}
+	for _, name := range DMGPalettePresetNames() {
+		pal, err := GetDMGPalettePreset(strings.ToUpper(name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if pal != DMGPalettePresets[name] {
+			t.Errorf("%s: lookup got a different palette", name)
+		}
+	}
+	if _, err := GetDMGPalettePreset("mauve"); err == nil || !strings.Contains(err.Error(), "green, grey, light, pocket") {
+		t.Errorf("unknown preset error is %v, want one listing the choices", err)
+	}
+}
+
+// the emulator draws with whatever palette it's given, BG and each OBJ palette separately
+func TestDMGPaletteRendering(t *testing.T) {
+	pal := DMGPalette{
+		BG:   [4]RGB{{1, 1, 1}, {2, 2, 2}, {3, 3, 3}, {4, 4, 4}},
+		OBJ0: [4]RGB{{10, 0, 0}, {20, 0, 0}, {30, 0, 0}, {40, 0, 0}},
+		OBJ1: [4]RGB{{0, 10, 0}, {0, 20, 0}, {0, 30, 0}, {0, 40, 0}},
+	}
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emu.SetDMGPalette(pal)
+	runFrames(emu, 1)
+	cs := emu.(*cpuState)
+	// a solid tile as two sprites on line 0, one per OBJ palette
+	for i := 0; i < 16; i++ {
+		cs.LCD.VideoRAM[0x7f0+i] = 0xff
+	}
+	copy(cs.LCD.OAM[0:], []byte{16, 8, 0x7f, 0x00})
+	copy(cs.LCD.OAM[4:], []byte{16, 8 + 8, 0x7f, 0x10})
+	cs.write(0xff40, 0x93)
+	cs.write(0xff47, 0xe4) // bg: identity
+	cs.write(0xff48, 0xe4) // obj0: identity
+	cs.write(0xff49, 0x1b) // obj1: reversed
+	runFrames(emu, 1)
+
+	fb := emu.Framebuffer()
+	pixel := func(x, y int) RGB {
+		i := (y*160 + x) * 4
+		return RGB{fb[i], fb[i+1], fb[i+2]}
+	}
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want RGB
+	}{
+		{"bg", 100, 100, pal.BG[0]},
+		{"obj0", 0, 0, pal.OBJ0[3]},
+		{"obj1", 8, 0, pal.OBJ1[0]},
+	} {
+		if got := pixel(tc.x, tc.y); got != tc.want {
+			t.Errorf("%s pixel is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// titleWithChecksum pads prefix with one byte so its bytes sum to sum
+func titleWithChecksum(prefix string, sum byte) string {
+	for _, b := range []byte(prefix) {
+		sum -= b
+	}
+	return prefix + string([]byte{sum})
+}
+
+func TestCGBColorizationPalette(t *testing.T) {
+	comboPalette := func(combo int) DMGPalette {
+		c := colorizationCombos[combo]
+		return DMGPalette{BG: colorizationColors(c[2]), OBJ0: colorizationColors(c[0]), OBJ1: colorizationColors(c[1])}
+	}
+	for _, tc := range []struct {
+		name string
+		ci   CartInfo
+		want DMGPalette
+	}{
+		{"not nintendo", CartInfo{Title: titleWithChecksum("ABC", 0x88), OldLicenseeCode: 0x08}, comboPalette(0)},
+		{"unique checksum", CartInfo{Title: titleWithChecksum("ABC", 0x88), OldLicenseeCode: 0x01},
+			comboPalette(int(colorizationComboForChecksum[0]))},
+		{"new licensee code", CartInfo{Title: titleWithChecksum("ABC", 0x88), OldLicenseeCode: 0x33, NewLicenseeCode: "01"},
+			comboPalette(int(colorizationComboForChecksum[0]))},
+		{"new licensee code, not nintendo", CartInfo{Title: titleWithChecksum("ABC", 0x88), OldLicenseeCode: 0x33, NewLicenseeCode: "08"},
+			comboPalette(0)},
+		{"unknown checksum", CartInfo{Title: titleWithChecksum("ABC", 0x00), OldLicenseeCode: 0x01}, comboPalette(0)},
+		// 0xb3 is shared three ways, split by the 4th letter: B, U, and R
+		{"shared checksum, 4th letter B", CartInfo{Title: titleWithChecksum("ABCB", 0xb3), OldLicenseeCode: 0x01},
+			comboPalette(int(colorizationComboForChecksum[64]))},
+		{"shared checksum, 4th letter U", CartInfo{Title: titleWithChecksum("ABCU", 0xb3), OldLicenseeCode: 0x01},
+			comboPalette(int(colorizationComboForChecksum[78]))},
+		{"shared checksum, 4th letter R", CartInfo{Title: titleWithChecksum("ABCR", 0xb3), OldLicenseeCode: 0x01},
+			comboPalette(int(colorizationComboForChecksum[92]))},
+		{"shared checksum, no matching letter", CartInfo{Title: titleWithChecksum("ABCZ", 0xb3), OldLicenseeCode: 0x01},
+			comboPalette(0)},
+		{"another shared checksum, 4th letter R", CartInfo{Title: titleWithChecksum("ABCR", 0x46), OldLicenseeCode: 0x01},
+			comboPalette(int(colorizationComboForChecksum[79]))},
+		// the manufacturer code counts towards the checksum, and the 4th letter can't be missing
+		{"short title", CartInfo{Title: "AB", ManufacturerCode: titleWithChecksum("", 0xb3-'A'-'B'), OldLicenseeCode: 0x01},
+			comboPalette(0)},
+	} {
+		if got := tc.ci.CGBColorizationPalette(); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	// sanity check the table lookups above
+	if colorizationTitleChecksums[64] != 0xb3 || colorizationTitleChecksums[78] != 0xb3 || colorizationTitleChecksums[92] != 0xb3 ||
+		colorizationTitleChecksums[79] != 0x46 || colorizationDupLetters[0] != 'B' ||
+		colorizationDupLetters[14] != 'U' || colorizationDupLetters[15] != 'R' || colorizationDupLetters[28] != 'R' {
+		t.Errorf("test assumes different boot rom tables")
+	}
+	for _, i := range []int{64, 78, 79, 92} {
+		if comboPalette(int(colorizationComboForChecksum[i])) == comboPalette(0) {
+			t.Errorf("test can't tell checksum %d's palette from the default", i)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package dmgo
+
+import (
+	"fmt"
+	"image"
+)
+
+// PaletteSwatch is one palette's four colors, decoded, from Palettes
+type PaletteSwatch struct {
+	Palette ViewerPalette
+
+	// Raw is the palette's value in hardware terms: 15-bit BGR colors
+	// from palette RAM on CGB, or shades (0-3, 0 lightest) from
+	// BGP/OBP0/OBP1 on DMG.
+	Raw [4]uint16
+
+	// Colors is what Raw looks like on screen, with the current DMG
+	// palette or color correction
+	Colors [4]RGB
+}
+
+// Palettes decodes every palette the game can use right now: bg0-bg7
+// and obj0-obj7 on CGB, or bg0 (BGP), obj0 (OBP0), and obj1 (OBP1) on
+// DMG, in that order.
+func (cs *cpuState) Palettes() []PaletteSwatch {
+	return cs.LCD.palettes()
+}
+
+func (lcd *lcd) viewerPalettes() []ViewerPalette {
+	if !lcd.CGBMode {
+		return []ViewerPalette{{}, {Sprite: true, Index: 0}, {Sprite: true, Index: 1}}
+	}
+	pals := []ViewerPalette{}
+	for _, sprite := range []bool{false, true} {
+		for i := 0; i < 8; i++ {
+			pals = append(pals, ViewerPalette{Sprite: sprite, Index: i})
+		}
+	}
+	return pals
+}
+
+func (lcd *lcd) palettes() []PaletteSwatch {
+	swatches := []PaletteSwatch{}
+	for _, vp := range lcd.viewerPalettes() {
+		s := PaletteSwatch{Palette: vp}
+		for i := byte(0); i < 4; i++ {
+			s.Raw[i] = lcd.rawPaletteValue(vp, i)
+			r, g, b := lcd.viewerColor(vp, i)
+			s.Colors[i] = RGB{r, g, b}
+		}
+		swatches = append(swatches, s)
+	}
+	return swatches
+}
+
+func (lcd *lcd) rawPaletteValue(vp ViewerPalette, colorIndex byte) uint16 {
+	if lcd.CGBMode {
+		return cgbPaletteColor(lcd.cgbPaletteRAM(vp), byte(vp.Index&0x07), colorIndex)
+	}
+	return uint16((*lcd.dmgPaletteReg(vp) >> (colorIndex * 2)) & 0x03)
+}
+
+func (lcd *lcd) cgbPaletteRAM(vp ViewerPalette) *[64]byte {
+	if vp.Sprite {
+		return &lcd.SpritePaletteRAM
+	}
+	return &lcd.BGPaletteRAM
+}
+
+func (lcd *lcd) dmgPaletteReg(vp ViewerPalette) *byte {
+	if !vp.Sprite {
+		return &lcd.BackgroundPaletteReg
+	}
+	if vp.Index&0x01 != 0 {
+		return &lcd.ObjectPalette1Reg
+	}
+	return &lcd.ObjectPalette0Reg
+}
+
+// SetPaletteColor overwrites one color (0-3) of a palette, in the same
+// terms as PaletteSwatch.Raw: a 15-bit BGR color on CGB, or a shade
+// (0-3) on DMG. It writes palette RAM / the palette register directly,
+// so it shows up from the next pixel drawn, until the game writes
+// that palette again.
+func (cs *cpuState) SetPaletteColor(vp ViewerPalette, colorIndex int, value uint16) error {
+	return cs.LCD.setPaletteColor(vp, colorIndex, value)
+}
+
+func (lcd *lcd) setPaletteColor(vp ViewerPalette, colorIndex int, value uint16) error {
+	if colorIndex < 0 || colorIndex > 3 {
+		return fmt.Errorf("bad color index %d, must be 0-3", colorIndex)
+	}
+	if vp.Index < 0 || vp.Index > 7 {
+		return fmt.Errorf("bad palette %v, must be bg0-bg7 or obj0-obj7", vp)
+	}
+	if lcd.CGBMode {
+		if value > 0x7fff {
+			return fmt.Errorf("bad color 0x%04x, must be 15-bit (0x0000-0x7fff)", value)
+		}
+		ram := lcd.cgbPaletteRAM(vp)
+		addr := 8*vp.Index + 2*colorIndex
+		ram[addr] = byte(value)
+		ram[addr+1] = byte(value >> 8)
+		return nil
+	}
+	if value > 3 {
+		return fmt.Errorf("bad shade %d, must be 0-3", value)
+	}
+	if vp.Index > 1 || (!vp.Sprite && vp.Index > 0) {
+		return fmt.Errorf("no palette %v on DMG, choices are bg0, obj0, obj1", vp)
+	}
+	reg := lcd.dmgPaletteReg(vp)
+	shift := uint(colorIndex * 2)
+	*reg = *reg&^(0x03<<shift) | byte(value)<<shift
+	return nil
+}
+
+// size of each color in PalettesImage
+const paletteSwatchSize = 16
+
+// PalettesImage draws the palettes from Palettes as rows of four
+// swatches, BG palettes down the left and OBJ palettes down the right.
+func (cs *cpuState) PalettesImage() *image.RGBA {
+	return cs.LCD.palettesImage()
+}
+
+func (lcd *lcd) palettesImage() *image.RGBA {
+	rows := 8
+	if !lcd.CGBMode {
+		rows = 2
+	}
+	const rowW = 4 * paletteSwatchSize
+	img := image.NewRGBA(image.Rect(0, 0, 2*rowW, rows*paletteSwatchSize))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for _, s := range lcd.palettes() {
+		x0, y0 := 0, s.Palette.Index*paletteSwatchSize
+		if s.Palette.Sprite {
+			x0 = rowW
+		}
+		for i, c := range s.Colors {
+			for y := 0; y < paletteSwatchSize; y++ {
+				for x := 0; x < paletteSwatchSize; x++ {
+					setImagePixel(img, x0+i*paletteSwatchSize+x, y0+y, c.R, c.G, c.B)
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,256 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// ApplyPatch applies an IPS, UPS, or BPS patch to the cart,
+// detecting the format from the patch's magic bytes. The cart
+// passed in is not modified.
+func ApplyPatch(cart []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return applyIPS(cart, patch)
+	case bytes.HasPrefix(patch, []byte("UPS1")):
+		return applyUPS(cart, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return applyBPS(cart, patch)
+	}
+	return nil, fmt.Errorf("unknown patch format")
+}
+
+// patchReader reads through a patch, remembering the first
+// overrun so the format parsers don't need to check every read
+type patchReader struct {
+	data    []byte
+	pos     int
+	overrun bool
+}
+
+func (r *patchReader) readByte() byte {
+	if r.pos >= len(r.data) {
+		r.overrun = true
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *patchReader) readBytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.overrun = true
+		r.pos = len(r.data)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *patchReader) readBE(n int) int {
+	val := 0
+	for i := 0; i < n; i++ {
+		val = (val << 8) | int(r.readByte())
+	}
+	return val
+}
+
+// the variable-length ints used by both UPS and BPS
+func (r *patchReader) readVarint() int {
+	val, shift := 0, 1
+	for !r.overrun {
+		b := r.readByte()
+		val += int(b&0x7f) * shift
+		if b&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		val += shift
+		if shift > 1<<42 {
+			// nothing this big will fit in a cart anyway
+			r.overrun = true
+		}
+	}
+	return val
+}
+
+func applyIPS(cart []byte, patch []byte) ([]byte, error) {
+	out := append([]byte{}, cart...)
+	r := patchReader{data: patch, pos: 5}
+	for {
+		if bytes.HasPrefix(r.data[r.pos:], []byte("EOF")) {
+			r.pos += 3
+			break
+		}
+		offset := r.readBE(3)
+		size := r.readBE(2)
+		var chunk []byte
+		if size == 0 {
+			rleSize := r.readBE(2)
+			val := r.readByte()
+			chunk = bytes.Repeat([]byte{val}, rleSize)
+		} else {
+			chunk = r.readBytes(size)
+		}
+		if r.overrun {
+			return nil, fmt.Errorf("ips patch: unexpected end of patch")
+		}
+		if end := offset + len(chunk); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], chunk)
+	}
+	// optional truncation extension
+	if len(r.data)-r.pos == 3 {
+		if truncSize := r.readBE(3); truncSize < len(out) {
+			out = out[:truncSize]
+		}
+	}
+	return out, nil
+}
+
+func readPatchFooter(patch []byte, format string) (uint32, uint32, error) {
+	if len(patch) < 12 {
+		return 0, 0, fmt.Errorf("%s patch: too small", format)
+	}
+	footer := patch[len(patch)-12:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:])
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != patchCRC {
+		return 0, 0, fmt.Errorf("%s patch: patch checksum mismatch, patch is corrupt", format)
+	}
+	return sourceCRC, targetCRC, nil
+}
+
+func applyUPS(cart []byte, patch []byte) ([]byte, error) {
+	sourceCRC, targetCRC, err := readPatchFooter(patch, "ups")
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(cart) != sourceCRC {
+		return nil, fmt.Errorf("ups patch: source checksum mismatch, wrong rom for this patch")
+	}
+
+	r := patchReader{data: patch[:len(patch)-12], pos: 4}
+	sourceSize := r.readVarint()
+	targetSize := r.readVarint()
+	if r.overrun || sourceSize != len(cart) {
+		return nil, fmt.Errorf("ups patch: bad header")
+	}
+	if targetSize < 0 || targetSize > maxCartFileSize {
+		return nil, fmt.Errorf("ups patch: target size %d is too big", targetSize)
+	}
+
+	out := make([]byte, targetSize)
+	copy(out, cart)
+	outPos := 0
+	for r.pos < len(r.data) {
+		outPos += r.readVarint()
+		for {
+			b := r.readByte()
+			if r.overrun {
+				return nil, fmt.Errorf("ups patch: unexpected end of patch")
+			}
+			if b == 0 {
+				outPos++
+				break
+			}
+			if outPos >= len(out) {
+				return nil, fmt.Errorf("ups patch: write past end of target")
+			}
+			out[outPos] ^= b
+			outPos++
+		}
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, fmt.Errorf("ups patch: target checksum mismatch after patching")
+	}
+	return out, nil
+}
+
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+func applyBPS(cart []byte, patch []byte) ([]byte, error) {
+	sourceCRC, targetCRC, err := readPatchFooter(patch, "bps")
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(cart) != sourceCRC {
+		return nil, fmt.Errorf("bps patch: source checksum mismatch, wrong rom for this patch")
+	}
+
+	r := patchReader{data: patch[:len(patch)-12], pos: 4}
+	sourceSize := r.readVarint()
+	targetSize := r.readVarint()
+	metadataSize := r.readVarint()
+	r.readBytes(metadataSize)
+	if r.overrun || sourceSize != len(cart) {
+		return nil, fmt.Errorf("bps patch: bad header")
+	}
+	if targetSize < 0 || targetSize > maxCartFileSize {
+		return nil, fmt.Errorf("bps patch: target size %d is too big", targetSize)
+	}
+
+	out := make([]byte, targetSize)
+	outPos, sourceRelPos, targetRelPos := 0, 0, 0
+	for r.pos < len(r.data) {
+		data := r.readVarint()
+		action, length := data&3, (data>>2)+1
+		if outPos+length > len(out) {
+			return nil, fmt.Errorf("bps patch: write past end of target")
+		}
+		switch action {
+		case bpsSourceRead:
+			if outPos+length > len(cart) {
+				return nil, fmt.Errorf("bps patch: read past end of source")
+			}
+			copy(out[outPos:], cart[outPos:outPos+length])
+		case bpsTargetRead:
+			copy(out[outPos:], r.readBytes(length))
+		case bpsSourceCopy, bpsTargetCopy:
+			offsetData := r.readVarint()
+			offset := offsetData >> 1
+			if offsetData&1 != 0 {
+				offset = -offset
+			}
+			if action == bpsSourceCopy {
+				sourceRelPos += offset
+				if sourceRelPos < 0 || sourceRelPos+length > len(cart) {
+					return nil, fmt.Errorf("bps patch: read past end of source")
+				}
+				copy(out[outPos:], cart[sourceRelPos:sourceRelPos+length])
+				sourceRelPos += length
+			} else {
+				targetRelPos += offset
+				if targetRelPos < 0 || targetRelPos >= outPos {
+					return nil, fmt.Errorf("bps patch: bad target copy offset")
+				}
+				// byte by byte, as overlapping copies are used for RLE
+				for i := 0; i < length; i++ {
+					out[outPos+i] = out[targetRelPos]
+					targetRelPos++
+				}
+			}
+		}
+		if r.overrun {
+			return nil, fmt.Errorf("bps patch: unexpected end of patch")
+		}
+		outPos += length
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, fmt.Errorf("bps patch: target checksum mismatch after patching")
+	}
+	return out, nil
+}
@@ -0,0 +1,231 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func testPatchSource() []byte {
+	src := make([]byte, 0x200)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+	return src
+}
+
+func encodeVarint(v int) []byte {
+	var out []byte
+	for {
+		x := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, 0x80|x)
+		}
+		out = append(out, x)
+		v--
+	}
+}
+
+func appendUint32LE(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// appends the source, target, and patch crcs
+func finishPatch(patch, src, dst []byte) []byte {
+	patch = appendUint32LE(patch, crc32.ChecksumIEEE(src))
+	patch = appendUint32LE(patch, crc32.ChecksumIEEE(dst))
+	return appendUint32LE(patch, crc32.ChecksumIEEE(patch))
+}
+
+func makeUPS(src, dst []byte) []byte {
+	patch := []byte("UPS1")
+	patch = append(patch, encodeVarint(len(src))...)
+	patch = append(patch, encodeVarint(len(dst))...)
+	xorAt := func(i int) byte {
+		if i < len(src) {
+			return src[i] ^ dst[i]
+		}
+		return dst[i]
+	}
+	last := 0
+	for pos := 0; pos < len(dst); {
+		if xorAt(pos) == 0 {
+			pos++
+			continue
+		}
+		patch = append(patch, encodeVarint(pos-last)...)
+		for ; pos < len(dst) && xorAt(pos) != 0; pos++ {
+			patch = append(patch, xorAt(pos))
+		}
+		patch = append(patch, 0)
+		pos++
+		last = pos
+	}
+	return finishPatch(patch, src, dst)
+}
+
+type bpsBuilder struct{ patch []byte }
+
+func newBPS(srcSize, dstSize int) *bpsBuilder {
+	b := &bpsBuilder{patch: []byte("BPS1")}
+	b.patch = append(b.patch, encodeVarint(srcSize)...)
+	b.patch = append(b.patch, encodeVarint(dstSize)...)
+	b.patch = append(b.patch, encodeVarint(0)...) // no metadata
+	return b
+}
+func (b *bpsBuilder) action(action, length int) {
+	b.patch = append(b.patch, encodeVarint((length-1)<<2|action)...)
+}
+func (b *bpsBuilder) relOffset(offset int) {
+	if offset < 0 {
+		b.patch = append(b.patch, encodeVarint(-offset<<1|1)...)
+	} else {
+		b.patch = append(b.patch, encodeVarint(offset<<1)...)
+	}
+}
+
+func TestIPSPatch(t *testing.T) {
+	src := testPatchSource()
+	patch := []byte("PATCH")
+	patch = append(patch, 0x00, 0x00, 0x10, 0x00, 0x03, 0xaa, 0xbb, 0xcc) // 3 bytes at 0x10
+	patch = append(patch, 0x00, 0x02, 0x08, 0x00, 0x00, 0x00, 0x10, 0xee) // rle 16 bytes, growing the rom
+	patch = append(patch, "EOF"...)
+
+	want := append([]byte{}, src...)
+	copy(want[0x10:], []byte{0xaa, 0xbb, 0xcc})
+	want = append(want, make([]byte, 0x208-0x200)...)
+	want = append(want, bytes.Repeat([]byte{0xee}, 16)...)
+
+	out, err := ApplyPatch(src, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, want) {
+		t.Errorf("ips patch output wrong")
+	}
+	if !bytes.Equal(src, testPatchSource()) {
+		t.Errorf("ips patch modified the source")
+	}
+
+	// truncation extension
+	out, err = ApplyPatch(src, append(append([]byte{}, patch...), 0x00, 0x00, 0x20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, want[:0x20]) {
+		t.Errorf("ips truncation output wrong")
+	}
+
+	for _, cut := range []int{6, 10, len(patch) - 3} {
+		if _, err := ApplyPatch(src, patch[:cut]); err == nil {
+			t.Errorf("ips patch cut to %d bytes applied without error", cut)
+		}
+	}
+}
+
+func TestUPSPatch(t *testing.T) {
+	src := testPatchSource()
+	dst := append(append([]byte{}, src...), 1, 2, 3, 0, 5)
+	dst[0] ^= 0xff
+	dst[0x100] = 0x42
+	dst[0x101] ^= 1
+
+	patch := makeUPS(src, dst)
+	out, err := ApplyPatch(src, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, dst) {
+		t.Errorf("ups patch output wrong")
+	}
+
+	checkPatchErrors(t, "ups", src, patch, func(targetSize int) []byte {
+		p := []byte("UPS1")
+		p = append(p, encodeVarint(len(src))...)
+		p = append(p, encodeVarint(targetSize)...)
+		return finishPatch(p, src, nil)
+	})
+}
+
+func TestBPSPatch(t *testing.T) {
+	src := testPatchSource()
+	dst := []byte{}
+	dst = append(dst, src[:0x20]...)                    // source read
+	dst = append(dst, 9, 8, 7, 6)                       // target read
+	dst = append(dst, bytes.Repeat([]byte{6}, 0x10)...) // target copy, rle style
+	dst = append(dst, src[0x100:0x110]...)              // source copy
+	dst = append(dst, src[0x80:0x88]...)                // source copy, backwards
+	dst = append(dst, dst[0x20:0x24]...)                // target copy, non-overlapping
+
+	b := newBPS(len(src), len(dst))
+	b.action(bpsSourceRead, 0x20)
+	b.action(bpsTargetRead, 4)
+	b.patch = append(b.patch, 9, 8, 7, 6)
+	b.action(bpsTargetCopy, 0x10)
+	b.relOffset(0x23) // last byte of the target read
+	b.action(bpsSourceCopy, 0x10)
+	b.relOffset(0x100)
+	b.action(bpsSourceCopy, 8)
+	b.relOffset(0x80 - 0x110)
+	b.action(bpsTargetCopy, 4)
+	b.relOffset(0x20 - 0x33)
+	patch := finishPatch(b.patch, src, dst)
+
+	out, err := ApplyPatch(src, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, dst) {
+		t.Errorf("bps patch output wrong:\n got %x\nwant %x", out, dst)
+	}
+
+	checkPatchErrors(t, "bps", src, patch, func(targetSize int) []byte {
+		return finishPatch(newBPS(len(src), targetSize).patch, src, nil)
+	})
+
+	// reads past the source
+	b = newBPS(len(src), 0x300)
+	b.action(bpsSourceRead, 0x300)
+	if _, err := ApplyPatch(src, finishPatch(b.patch, src, nil)); err == nil {
+		t.Errorf("bps source read past the end applied without error")
+	}
+	b = newBPS(len(src), 0x10)
+	b.action(bpsTargetCopy, 0x10)
+	b.relOffset(0)
+	if _, err := ApplyPatch(src, finishPatch(b.patch, src, nil)); err == nil {
+		t.Errorf("bps target copy of unwritten bytes applied without error")
+	}
+}
+
+// the checks UPS and BPS share: crcs, truncation, and huge sizes
+func checkPatchErrors(t *testing.T, format string, src, patch []byte, withTargetSize func(int) []byte) {
+	expectErr := func(what string, cart, patch []byte, contains string) {
+		t.Helper()
+		_, err := ApplyPatch(cart, patch)
+		if err == nil {
+			t.Errorf("%s patch with %s applied without error", format, what)
+		} else if !strings.Contains(err.Error(), contains) {
+			t.Errorf("%s patch with %s: got error %q, want one mentioning %q", format, what, err, contains)
+		}
+	}
+
+	wrongSrc := append([]byte{}, src...)
+	wrongSrc[5]++
+	expectErr("the wrong source", wrongSrc, patch, "source checksum")
+
+	corrupt := append([]byte{}, patch...)
+	corrupt[len(corrupt)/2] ^= 0x10
+	expectErr("a corrupt byte", src, corrupt, "patch checksum")
+
+	wrongTarget := append([]byte{}, patch...)
+	wrongTarget[len(wrongTarget)-8]++
+	binary.LittleEndian.PutUint32(wrongTarget[len(wrongTarget)-4:], crc32.ChecksumIEEE(wrongTarget[:len(wrongTarget)-4]))
+	expectErr("the wrong target crc", src, wrongTarget, "target checksum")
+
+	expectErr("no footer", src, patch[:8], "")
+	expectErr("a huge target size", src, withTargetSize(1<<40), "too big")
+	expectErr("a target size just over the limit", src, withTargetSize(maxCartFileSize+1), "too big")
+}
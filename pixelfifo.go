@@ -0,0 +1,282 @@
+package dmgo
+
+// Pixel transfer (mode 3) runs a dot at a time. A background/window
+// fetcher fills the bg FIFO 8 pixels at a time, which is shifted out
+// one pixel per dot, mixed with the sprite FIFO. Mode 3 is 172 dots at
+// minimum, stretched by SCX fine scroll, the window starting, and the
+// stalls while sprites are fetched. Because palettes and control regs
+// are read as each pixel goes out, mid-scanline writes take effect at
+// the pixel they land on.
+
+type bgFifoPixel struct {
+	Color    byte
+	Palette  byte
+	Priority bool
+	Window   bool
+}
+
+type spriteFifoPixel struct {
+	Color    byte // 0 means transparent/empty
+	Flags    byte
+	OAMIndex byte
+}
+
+type pixelFetcher struct {
+	Dot       byte // dots into the current tile fetch, 6 means waiting to push
+	TileX     byte
+	TileNum   byte
+	TileAttrs byte
+	DataLow   byte
+	DataHigh  byte
+
+	DiscardFetch   bool // the first fetch of every line gets thrown away
+	FetchingWindow bool
+
+	BGFifo    [8]bgFifoPixel
+	BGFifoLen byte
+
+	SpriteFifo [8]spriteFifoPixel
+
+	PixelX          byte
+	PixelsToDiscard byte
+
+	SpriteStallDots  byte
+	StalledSprite    byte
+	SpritesFetched   uint64
+	LastPenaltyTileX int
+}
+
+func (lcd *lcd) startPixelTransfer() {
+	lcd.Fetcher = pixelFetcher{
+		DiscardFetch:     true,
+		PixelsToDiscard:  lcd.ScrollX & 0x07,
+		LastPenaltyTileX: -1,
+	}
+}
+
+// returns true when the scanline is finished
+func (lcd *lcd) runPixelTransferDot() bool {
+	f := &lcd.Fetcher
+
+	if f.SpriteStallDots > 0 {
+		f.SpriteStallDots--
+		if f.SpriteStallDots == 0 {
+			lcd.fetchSpriteRow(&lcd.OAMForScanline[f.StalledSprite])
+		}
+		return false
+	}
+
+	lcd.tickFetcher()
+
+	if f.BGFifoLen == 0 {
+		return false
+	}
+	if lcd.windowShouldStart() {
+		lcd.startWindowFetch()
+		return false
+	}
+	if f.PixelsToDiscard > 0 {
+		f.PixelsToDiscard--
+		f.BGFifoLen--
+		return false
+	}
+	if lcd.startSpriteFetch() {
+		return false
+	}
+
+	lcd.shiftOutPixel()
+	return f.PixelX == 160
+}
+
+func (lcd *lcd) tickFetcher() {
+	f := &lcd.Fetcher
+	if f.Dot < 6 {
+		f.Dot++
+		switch f.Dot {
+		case 2:
+			mapAddr, x, y := lcd.fetcherMapCoords()
+			f.TileNum = lcd.getTileNum(mapAddr, x, y)
+			f.TileAttrs = lcd.getTileAttrByte(mapAddr, x, y)
+		case 4:
+			f.DataLow = lcd.VideoRAM[lcd.fetcherDataAddr()]
+		case 6:
+			f.DataHigh = lcd.VideoRAM[lcd.fetcherDataAddr()+1]
+			if f.DiscardFetch {
+				f.DiscardFetch = false
+				f.Dot = 0
+			}
+		}
+		return
+	}
+
+	if f.BGFifoLen == 0 {
+		attrs := tileAttrsFromByte(f.TileAttrs)
+		for i := byte(0); i < 8; i++ {
+			f.BGFifo[i] = bgFifoPixel{
+				Color:    tileRowPixel(f.DataLow, f.DataHigh, i, attrs.xFlip),
+				Palette:  attrs.bgPaletteNum,
+				Priority: attrs.hasPriority,
+				Window:   f.FetchingWindow,
+			}
+		}
+		f.BGFifoLen = 8
+		f.Dot = 0
+		f.TileX++
+	}
+}
+
+func (lcd *lcd) fetcherMapCoords() (uint16, byte, byte) {
+	f := &lcd.Fetcher
+	if f.FetchingWindow {
+		return lcd.getWindowTileMapAddr(), f.TileX << 3, lcd.LWY
+	}
+	return lcd.getBGTileMapAddr(), lcd.ScrollX + f.TileX<<3, lcd.LYReg + lcd.ScrollY
+}
+
+func (lcd *lcd) fetcherDataAddr() uint16 {
+	_, _, y := lcd.fetcherMapCoords()
+	attrs := tileAttrsFromByte(lcd.Fetcher.TileAttrs)
+	return lcd.getTileDataAddr(lcd.getBGAndWindowTileDataAddr(), attrs, lcd.Fetcher.TileNum, y)
+}
+
+func tileRowPixel(dataLow, dataHigh, x byte, xFlip bool) byte {
+	bit := 7 - x
+	if xFlip {
+		bit = x
+	}
+	return ((dataHigh>>bit)&0x01)<<1 | (dataLow>>bit)&0x01
+}
+
+func (lcd *lcd) windowShouldStart() bool {
+	f := &lcd.Fetcher
+	return !f.FetchingWindow && lcd.DisplayWindow && lcd.BGWindowMasterEnable &&
+		lcd.PassedWindowY && int(f.PixelX)+7 >= int(lcd.WindowX)
+}
+
+func (lcd *lcd) startWindowFetch() {
+	f := &lcd.Fetcher
+	f.FetchingWindow = true
+	f.BGFifoLen = 0
+	f.TileX = 0
+	f.LastPenaltyTileX = -1
+	f.PixelsToDiscard = 0
+	if lcd.WindowX < 7 {
+		f.PixelsToDiscard = 7 - lcd.WindowX
+	}
+	// fetcher restarts right away, this dot counts as its first
+	f.Dot = 0
+	lcd.tickFetcher()
+}
+
+func (lcd *lcd) startSpriteFetch() bool {
+	if !lcd.DisplaySprites {
+		return false
+	}
+	f := &lcd.Fetcher
+	for i := range lcd.OAMForScanline {
+		if f.SpritesFetched&(1<<uint(i)) != 0 {
+			continue
+		}
+		e := &lcd.OAMForScanline[i]
+		if e.X == int16(f.PixelX) || (e.X < 0 && f.PixelX == 0) {
+			f.SpritesFetched |= 1 << uint(i)
+			if e.OverLimit {
+				// not a real fetch, so no stall and mode 3 timing stays accurate
+				lcd.fetchSpriteRow(e)
+				continue
+			}
+			f.StalledSprite = byte(i)
+			// this dot is the first of the stall
+			f.SpriteStallDots = lcd.spriteFetchPenalty() - 1
+			return true
+		}
+	}
+	return false
+}
+
+// 6 dots for the fetch itself, plus however long the bg fetcher needs to
+// finish the tile it's on, which is only paid by the first sprite on a tile
+func (lcd *lcd) spriteFetchPenalty() byte {
+	f := &lcd.Fetcher
+	pos := int(f.PixelX) + int(lcd.ScrollX)
+	if f.FetchingWindow {
+		pos = int(f.PixelX) + 7 - int(lcd.WindowX)
+	}
+	penalty := byte(6)
+	if tileX := pos >> 3; tileX != f.LastPenaltyTileX {
+		f.LastPenaltyTileX = tileX
+		if offset := pos & 0x07; offset < 5 {
+			penalty += byte(5 - offset)
+		}
+	}
+	return penalty
+}
+
+func (lcd *lcd) fetchSpriteRow(e *oamEntry) {
+	f := &lcd.Fetcher
+	if lcd.layerToggles.spriteHidden(e.Index) {
+		return // as if fully transparent, so sprites under it show through
+	}
+
+	dataLow, dataHigh := lcd.spriteRowData(e, byte(int16(lcd.LYReg)-e.Y))
+
+	for i := 0; i < 8; i++ {
+		screenX := int(e.X) + i
+		if screenX < int(f.PixelX) {
+			continue // offscreen to the left
+		}
+		color := tileRowPixel(dataLow, dataHigh, byte(i), e.xFlip())
+		if color == 0 {
+			continue
+		}
+		// DMG: first sprite fetched (lowest x) wins. CGB: lowest oam index wins.
+		slot := &f.SpriteFifo[screenX-int(f.PixelX)]
+		if slot.Color == 0 || (lcd.CGBMode && e.Index < slot.OAMIndex) {
+			*slot = spriteFifoPixel{Color: color, Flags: e.FlagsByte, OAMIndex: e.Index}
+		}
+	}
+}
+
+// row is counted from the top of the sprite as drawn, i.e. after any y flip
+func (lcd *lcd) spriteRowData(e *oamEntry, row byte) (byte, byte) {
+	tileY := row
+	if e.yFlip() {
+		tileY = e.Height - 1 - tileY
+	}
+	tileNum := e.TileNum
+	if e.Height == 16 {
+		tileNum &^= 0x01
+		if tileY >= 8 {
+			tileNum++
+		}
+	}
+	attrs := tileAttrs{useHighBank: e.cgbUseHighBank()}
+	addr := lcd.getTileDataAddr(0x0000, attrs, tileNum, tileY) // addr 8000 relative
+	return lcd.VideoRAM[addr], lcd.VideoRAM[addr+1]
+}
+
+func (lcd *lcd) shiftOutPixel() {
+	f := &lcd.Fetcher
+
+	bg := f.BGFifo[8-f.BGFifoLen]
+	f.BGFifoLen--
+
+	sprite := f.SpriteFifo[0]
+	copy(f.SpriteFifo[:], f.SpriteFifo[1:])
+	f.SpriteFifo[7] = spriteFifoPixel{}
+
+	if !lcd.BGWindowMasterEnable || lcd.layerToggles.bgPixelHidden(bg) {
+		bg = bgFifoPixel{}
+	}
+
+	r, g, b := lcd.applyBGPalettes(tileAttrs{bgPaletteNum: bg.Palette}, bg.Color)
+	if sprite.Color != 0 && lcd.DisplaySprites {
+		e := oamEntry{FlagsByte: sprite.Flags}
+		hideSprite := lcd.BGWindowPrioritiesActive && (bg.Priority || e.behindBG()) && bg.Color != 0
+		if !hideSprite {
+			r, g, b = lcd.applySpritePalettes(&e, sprite.Color)
+		}
+	}
+	lcd.setFramebufferPixel(f.PixelX, lcd.LYReg, r, g, b)
+	f.PixelX++
+}
@@ -0,0 +1,135 @@
+package dmgo
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FramebufferImage copies a framebuffer (e.g. from Framebuffer) into
+// a 160x144 image
+func FramebufferImage(framebuffer []byte) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 160, 144))
+	copy(img.Pix, framebuffer)
+	return img
+}
+
+// SaveScreenshot writes the screen as it is right now to a png
+func SaveScreenshot(filename string, emu Emulator) error {
+	return writePNGFile(filename, FramebufferImage(emu.Framebuffer()), png.DefaultCompression)
+}
+
+func writePNGFile(filename string, img image.Image, level png.CompressionLevel) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := png.Encoder{CompressionLevel: level}
+	err = enc.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Recorder saves gameplay as it's played. The frontend hands it every
+// frame it gets from Framebuffer when FlipRequested, and passes it to
+// SetSoundRecorder to get the sound.
+type Recorder interface {
+	WriteFrame(framebuffer []byte) error
+	WriteAudio(samples []byte) error
+	// Close finishes the files. The recording is unreadable without it.
+	Close() error
+}
+
+// RecordingFormat picks what NewRecorder writes
+type RecordingFormat int
+
+const (
+	// RecordAVI is one uncompressed .avi with the sound in it
+	RecordAVI RecordingFormat = iota
+	// RecordPNGs is a directory of numbered .png frames and
+	// an audio.wav, for feeding to other tools
+	RecordPNGs
+)
+
+var recordingFormatNames = map[string]RecordingFormat{
+	"avi": RecordAVI,
+	"png": RecordPNGs,
+}
+
+func (rf RecordingFormat) String() string {
+	for name, f := range recordingFormatNames {
+		if f == rf {
+			return name
+		}
+	}
+	return fmt.Sprintf("RecordingFormat(%d)", int(rf))
+}
+
+// RecordingFormatNames returns the names GetRecordingFormat accepts, sorted
+func RecordingFormatNames() []string {
+	names := []string{}
+	for name := range recordingFormatNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetRecordingFormat looks up a RecordingFormat by name, ignoring case
+func GetRecordingFormat(name string) (RecordingFormat, error) {
+	if rf, ok := recordingFormatNames[strings.ToLower(name)]; ok {
+		return rf, nil
+	}
+	return 0, fmt.Errorf("unknown recording format %q, choices are: %s", name, strings.Join(RecordingFormatNames(), ", "))
+}
+
+// NewRecorder starts a recording at path: a file for RecordAVI, a
+// directory (created if needed) for RecordPNGs. Frames are recorded at
+// the Game Boy's ~59.73fps and sound as 44.1kHz 16-bit stereo.
+func NewRecorder(format RecordingFormat, path string) (Recorder, error) {
+	switch format {
+	case RecordAVI:
+		return newAVIRecorder(path)
+	case RecordPNGs:
+		return newPNGSequenceRecorder(path)
+	}
+	return nil, fmt.Errorf("unknown recording format %v", format)
+}
+
+type pngSequenceRecorder struct {
+	dir       string
+	numFrames int
+	wav       *wavWriter
+}
+
+func newPNGSequenceRecorder(dir string) (*pngSequenceRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	wav, err := createWAV(filepath.Join(dir, "audio.wav"))
+	if err != nil {
+		return nil, err
+	}
+	return &pngSequenceRecorder{dir: dir, wav: wav}, nil
+}
+
+func (r *pngSequenceRecorder) WriteFrame(framebuffer []byte) error {
+	filename := filepath.Join(r.dir, fmt.Sprintf("frame%06d.png", r.numFrames))
+	r.numFrames++
+	// BestSpeed to keep up at full frame rate
+	return writePNGFile(filename, FramebufferImage(framebuffer), png.BestSpeed)
+}
+
+func (r *pngSequenceRecorder) WriteAudio(samples []byte) error {
+	return r.wav.write(samples)
+}
+
+func (r *pngSequenceRecorder) Close() error {
+	return r.wav.close()
+}
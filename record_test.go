@@ -0,0 +1,231 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type riffChunk struct {
+	id   string
+	data []byte
+	// where the chunk's id starts in the file
+	offset int
+}
+
+// splits b into chunks, checking each fits. offset is where b starts in the file.
+func readRIFFChunks(t *testing.T, b []byte, offset int) []riffChunk {
+	t.Helper()
+	chunks := []riffChunk{}
+	for i := 0; i < len(b); {
+		if i+8 > len(b) {
+			t.Fatalf("chunk header at %d cut off", offset+i)
+		}
+		size := int(binary.LittleEndian.Uint32(b[i+4:]))
+		if i+8+size > len(b) {
+			t.Fatalf("chunk %q at %d is %d bytes, only %d left", b[i:i+4], offset+i, size, len(b)-i-8)
+		}
+		chunks = append(chunks, riffChunk{id: string(b[i : i+4]), data: b[i+8 : i+8+size], offset: offset + i})
+		i += 8 + size + size&1
+	}
+	return chunks
+}
+
+func TestAVIStructure(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.avi")
+	rec, err := NewRecorder(RecordAVI, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 160*144*4)
+	audio := make([]byte, 1000*soundBytesPerSample)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+	// sound arrives in odd sizes, sometimes split mid-sample
+	audioChunks := [][]byte{audio[:738*4], audio[:739*4+2], audio[:2], nil, audio[:100*4]}
+	wantSamples := 0
+	for i, chunk := range audioChunks {
+		if err := rec.WriteAudio(chunk); err != nil {
+			t.Fatal(err)
+		}
+		wantSamples += len(chunk)
+		frame[0] = byte(i)
+		if err := rec.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantSamples /= soundBytesPerSample
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wantFrames := uint32(len(audioChunks))
+
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	riff := readRIFFChunks(t, file, 0)
+	if len(riff) != 1 || riff[0].id != "RIFF" || string(riff[0].data[:4]) != "AVI " {
+		t.Fatalf("not one RIFF AVI chunk covering the file")
+	}
+	top := readRIFFChunks(t, riff[0].data[4:], 12)
+	if len(top) != 3 || top[0].id != "LIST" || top[1].id != "LIST" || top[2].id != "idx1" {
+		t.Fatalf("expected hdrl LIST, movi LIST, idx1, got %v chunks", len(top))
+	}
+	hdrl, movi, idx1 := top[0], top[1], top[2]
+	if string(hdrl.data[:4]) != "hdrl" || len(hdrl.data) != aviHeaderListSize {
+		t.Errorf("hdrl list is %q, %d bytes", hdrl.data[:4], len(hdrl.data))
+	}
+	if string(movi.data[:4]) != "movi" || movi.offset+8 != aviMoviFourCCOffset {
+		t.Fatalf("movi list is %q at %d", movi.data[:4], movi.offset)
+	}
+
+	u32At := func(offset int) uint32 { return binary.LittleEndian.Uint32(file[offset:]) }
+	if got := u32At(aviTotalFramesOffset); got != wantFrames {
+		t.Errorf("avih total frames is %d, want %d", got, wantFrames)
+	}
+	if got := u32At(aviVideoLengthOffset); got != wantFrames {
+		t.Errorf("video stream length is %d, want %d", got, wantFrames)
+	}
+	if got := u32At(aviAudioLengthOffset); got != uint32(wantSamples) {
+		t.Errorf("audio stream length is %d, want %d", got, wantSamples)
+	}
+	// the patched fields sit where the header says they should
+	if string(file[aviVideoLengthOffset-32:aviVideoLengthOffset-28]) != "vids" ||
+		string(file[aviAudioLengthOffset-32:aviAudioLengthOffset-28]) != "auds" {
+		t.Errorf("stream length offsets don't line up with the strh chunks")
+	}
+
+	data := readRIFFChunks(t, movi.data[4:], movi.offset+12)
+	frames, samples := uint32(0), 0
+	for _, c := range data {
+		switch c.id {
+		case "00db":
+			if len(c.data) != aviFrameSize {
+				t.Errorf("frame chunk is %d bytes", len(c.data))
+			}
+			frames++
+		case "01wb":
+			samples += len(c.data) / soundBytesPerSample
+		default:
+			t.Errorf("unexpected chunk %q in movi", c.id)
+		}
+	}
+	if frames != wantFrames || samples != wantSamples {
+		t.Errorf("movi has %d frames and %d samples, want %d and %d", frames, samples, wantFrames, wantSamples)
+	}
+
+	if len(idx1.data) != 16*len(data) {
+		t.Fatalf("idx1 has %d bytes for %d chunks", len(idx1.data), len(data))
+	}
+	for i, c := range data {
+		entry := idx1.data[i*16:]
+		offset := aviMoviFourCCOffset + int(binary.LittleEndian.Uint32(entry[8:]))
+		if string(entry[:4]) != c.id || offset != c.offset || int(binary.LittleEndian.Uint32(entry[12:])) != len(c.data) {
+			t.Errorf("idx1 entry %d is %q at %d size %d, want %q at %d size %d", i,
+				entry[:4], offset, binary.LittleEndian.Uint32(entry[12:]), c.id, c.offset, len(c.data))
+		}
+	}
+}
+
+// the recorder gets its sound from the APU, so each frame gets the
+// emulated amount of sound however playback reads the buffer
+func TestRecorderSoundFromAPU(t *testing.T) {
+	// the APU runs at half the cpu clock, and makes a sample every clocksPerSample
+	perFrame := float64(aviFrameRateDen/2) / clocksPerSample
+	for _, tc := range []struct {
+		name string
+		read func(emu Emulator, frame int, flipped bool)
+	}{
+		{"uneven reads", func(emu Emulator, frame int, flipped bool) {
+			// big uneven reads, nothing like a frame's worth
+			if emu.GetSoundBufferInfo().UsedSize >= 4096 {
+				emu.ReadSoundBuffer(make([]byte, 4096-frame%3*4))
+			}
+		}},
+		{"reading more than is buffered", func(emu Emulator, frame int, flipped bool) {
+			if flipped && frame%10 == 9 {
+				emu.ReadSoundBuffer(make([]byte, emu.GetSoundBufferInfo().UsedSize+1000*soundBytesPerSample))
+			}
+		}},
+		{"no reads, buffer full", func(emu Emulator, frame int, flipped bool) {}},
+	} {
+		emu, err := NewEmulator(testROM(soundTestProgram...), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// boot takes longer than a frame, so start from the first one
+		runFrames(emu, 1)
+		rec := &countingRecorder{}
+		emu.SetSoundRecorder(rec)
+		const frames = 120
+		for rec.frames < frames {
+			emu.Step()
+			flipped := emu.FlipRequested()
+			if flipped {
+				rec.WriteFrame(emu.Framebuffer())
+			}
+			tc.read(emu, rec.frames, flipped)
+		}
+		if err := emu.SetSoundRecorder(nil); err != nil {
+			t.Fatal(err)
+		}
+		for i, n := range rec.samplesPerFrame {
+			if float64(n) < perFrame-1 || float64(n) > perFrame+1 {
+				t.Errorf("%s: frame %d got %d samples, want about %v", tc.name, i, n, perFrame)
+				break
+			}
+		}
+	}
+}
+
+type countingRecorder struct {
+	frames          int
+	audioBytes      int
+	samplesPerFrame []int
+}
+
+func (r *countingRecorder) WriteFrame(framebuffer []byte) error {
+	r.frames++
+	r.samplesPerFrame = append(r.samplesPerFrame, r.audioBytes/soundBytesPerSample)
+	r.audioBytes = 0
+	return nil
+}
+func (r *countingRecorder) WriteAudio(samples []byte) error {
+	r.audioBytes += len(samples)
+	return nil
+}
+func (r *countingRecorder) Close() error { return nil }
+
+func TestPNGRecorder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rec")
+	rec, err := NewRecorder(RecordPNGs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := bytes.Repeat([]byte{1, 2, 3, 0xff}, 160*144)
+	for i := 0; i < 3; i++ {
+		rec.WriteAudio(make([]byte, 738*soundBytesPerSample))
+		if err := rec.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"frame000000.png", "frame000002.png"} {
+		if _, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	wav, err := ioutil.ReadFile(filepath.Join(dir, "audio.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wav) != wavHeaderSize+3*738*soundBytesPerSample {
+		t.Errorf("wav is %d bytes", len(wav))
+	}
+}
@@ -0,0 +1,103 @@
+package scale
+
+import "sync"
+
+// Scale2x/Scale3x (AdvanceMAME's take on EPX): copy a neighbor into a
+// corner when the two neighbors on that side agree and the others don't,
+// which turns staircases into diagonals without adding any new colors.
+
+// the 2x2 block pixel x,y turns into
+func scale2xBlock(src *frame, x, y int) (e0, e1, e2, e3 uint32) {
+	p := src.at(x, y)
+	a, b, c, d := src.at(x, y-1), src.at(x+1, y), src.at(x-1, y), src.at(x, y+1)
+	e0, e1, e2, e3 = p, p, p, p
+	if c == a && c != d && a != b {
+		e0 = a
+	}
+	if a == b && a != c && b != d {
+		e1 = b
+	}
+	if d == c && d != b && c != a {
+		e2 = c
+	}
+	if b == d && b != a && d != c {
+		e3 = d
+	}
+	return e0, e1, e2, e3
+}
+
+func scale2x(dst []byte, src *frame) {
+	dstW := src.w * 2
+	for y := 0; y < src.h; y++ {
+		for x := 0; x < src.w; x++ {
+			e0, e1, e2, e3 := scale2xBlock(src, x, y)
+			put(dst, dstW, x*2, y*2, e0)
+			put(dst, dstW, x*2+1, y*2, e1)
+			put(dst, dstW, x*2, y*2+1, e2)
+			put(dst, dstW, x*2+1, y*2+1, e3)
+		}
+	}
+}
+
+func scale3x(dst []byte, src *frame) {
+	dstW := src.w * 3
+	for y := 0; y < src.h; y++ {
+		for x := 0; x < src.w; x++ {
+			a, b, c := src.at(x-1, y-1), src.at(x, y-1), src.at(x+1, y-1)
+			d, e, f := src.at(x-1, y), src.at(x, y), src.at(x+1, y)
+			g, h, i := src.at(x-1, y+1), src.at(x, y+1), src.at(x+1, y+1)
+
+			out := [9]uint32{e, e, e, e, e, e, e, e, e}
+			if b != h && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == h && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (h == f && e != c) {
+					out[5] = f
+				}
+				if d == h {
+					out[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					out[7] = h
+				}
+				if h == f {
+					out[8] = f
+				}
+			}
+			for j := 0; j < 9; j++ {
+				put(dst, dstW, x*3+j%3, y*3+j/3, out[j])
+			}
+		}
+	}
+}
+
+// the 2x frame in the middle of scale4x, kept between calls
+var scale4xMid = sync.Pool{New: func() interface{} { return &frame{} }}
+
+// Scale2x, twice
+func scale4x(dst []byte, src *frame) {
+	mid := scale4xMid.Get().(*frame)
+	defer scale4xMid.Put(mid)
+	mid.w, mid.h = src.w*2, src.h*2
+	if cap(mid.pix) < mid.w*mid.h {
+		mid.pix = make([]uint32, mid.w*mid.h)
+	}
+	mid.pix = mid.pix[:mid.w*mid.h]
+	for y := 0; y < src.h; y++ {
+		for x := 0; x < src.w; x++ {
+			i := y*2*mid.w + x*2
+			mid.pix[i], mid.pix[i+1], mid.pix[i+mid.w], mid.pix[i+mid.w+1] = scale2xBlock(src, x, y)
+		}
+	}
+	scale2x(dst, mid)
+}
@@ -0,0 +1,34 @@
+package scale
+
+// The DMG's dot-matrix look: each pixel becomes a block with a thin gap
+// on its right and bottom. On the real screen the gaps are unlit LCD,
+// so they're blended toward the lightest color in the frame, which for
+// DMG games is usually the palette's background shade.
+
+func lcdGrid(factor int) func(dst []byte, src *frame) {
+	return func(dst []byte, src *frame) {
+		lightest, lightestY := uint32(0), -1
+		for _, c := range src.pix {
+			if y, _, _ := toYUV(c); y > lightestY {
+				lightest, lightestY = c, y
+			}
+		}
+
+		dstW := src.w * factor
+		for y := 0; y < src.h; y++ {
+			for x := 0; x < src.w; x++ {
+				c := src.at(x, y)
+				gap := mix2(c, 1, lightest, 1)
+				for j := 0; j < factor; j++ {
+					for i := 0; i < factor; i++ {
+						if i == factor-1 || j == factor-1 {
+							put(dst, dstW, x*factor+i, y*factor+j, gap)
+						} else {
+							put(dst, dstW, x*factor+i, y*factor+j, c)
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package scale upscales RGBA frames (e.g. dmgo's 160x144 framebuffer)
+// on the CPU, so the same filters work in a window, a screenshot, or a
+// recording made by a headless tool.
+package scale
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Scaler is an upscaling filter
+type Scaler struct {
+	Name   string
+	Factor int
+
+	fn func(dst []byte, src *frame)
+}
+
+var scalers = []Scaler{
+	{Name: "none", Factor: 1, fn: nearest(1)},
+	{Name: "nearest2x", Factor: 2, fn: nearest(2)},
+	{Name: "nearest3x", Factor: 3, fn: nearest(3)},
+	{Name: "nearest4x", Factor: 4, fn: nearest(4)},
+	{Name: "scale2x", Factor: 2, fn: scale2x},
+	{Name: "scale3x", Factor: 3, fn: scale3x},
+	{Name: "scale4x", Factor: 4, fn: scale4x},
+	{Name: "xbr2x", Factor: 2, fn: xbr2x},
+	{Name: "lcd3x", Factor: 3, fn: lcdGrid(3)},
+	{Name: "lcd4x", Factor: 4, fn: lcdGrid(4)},
+}
+
+// Names lists the available scalers
+func Names() []string {
+	names := []string{}
+	for _, s := range scalers {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Get looks up a scaler by name (case-insensitive)
+func Get(name string) (Scaler, error) {
+	for _, s := range scalers {
+		if strings.EqualFold(s.Name, name) {
+			return s, nil
+		}
+	}
+	return Scaler{}, fmt.Errorf("unknown scaler %q, choices are: %s", name, strings.Join(Names(), ", "))
+}
+
+// Scale upscales src, a w by h RGBA image (4 bytes per pixel, no
+// padding), into dst, which must hold w*Factor by h*Factor RGBA pixels.
+// Alpha is ignored and comes out as 0xff.
+func (s Scaler) Scale(dst, src []byte, w, h int) {
+	if len(src) < w*h*4 {
+		panic(fmt.Sprintf("scale: src is %d bytes, need %d for %dx%d", len(src), w*h*4, w, h))
+	}
+	if need := w * h * s.Factor * s.Factor * 4; len(dst) < need {
+		panic(fmt.Sprintf("scale: dst is %d bytes, need %d for %s", len(dst), need, s.Name))
+	}
+	s.fn(dst, newFrame(src, w, h))
+}
+
+// ScaleImage upscales img into a new image
+func (s Scaler) ScaleImage(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	src := img.Pix
+	if img.Stride != w*4 || len(img.Pix) != w*h*4 {
+		src = make([]byte, w*h*4)
+		for y := 0; y < h; y++ {
+			start := img.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			copy(src[y*w*4:(y+1)*w*4], img.Pix[start:start+w*4])
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w*s.Factor, h*s.Factor))
+	s.Scale(out.Pix, src, w, h)
+	return out
+}
+
+// colors are 0xRRGGBB
+type frame struct {
+	pix  []uint32
+	w, h int
+}
+
+func newFrame(src []byte, w, h int) *frame {
+	f := &frame{pix: make([]uint32, w*h), w: w, h: h}
+	for i := range f.pix {
+		f.pix[i] = uint32(src[i*4])<<16 | uint32(src[i*4+1])<<8 | uint32(src[i*4+2])
+	}
+	return f
+}
+
+// clamps to the edges, which is what all the filters want
+func (f *frame) at(x, y int) uint32 {
+	if x < 0 {
+		x = 0
+	} else if x >= f.w {
+		x = f.w - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= f.h {
+		y = f.h - 1
+	}
+	return f.pix[y*f.w+x]
+}
+
+func put(dst []byte, dstW, x, y int, c uint32) {
+	i := (y*dstW + x) * 4
+	dst[i+0] = byte(c >> 16)
+	dst[i+1] = byte(c >> 8)
+	dst[i+2] = byte(c)
+	dst[i+3] = 0xff
+}
+
+func nearest(factor int) func(dst []byte, src *frame) {
+	return func(dst []byte, src *frame) {
+		dstW := src.w * factor
+		for y := 0; y < src.h; y++ {
+			for x := 0; x < src.w; x++ {
+				c := src.at(x, y)
+				for j := 0; j < factor; j++ {
+					for i := 0; i < factor; i++ {
+						put(dst, dstW, x*factor+i, y*factor+j, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func channels(c uint32) (uint32, uint32, uint32) {
+	return c >> 16 & 0xff, c >> 8 & 0xff, c & 0xff
+}
+
+// weighted average of two colors
+func mix2(a, wa, b, wb uint32) uint32 {
+	return mix3(a, wa, b, wb, 0, 0)
+}
+
+// weighted average of three colors
+func mix3(a, wa, b, wb, c, wc uint32) uint32 {
+	ar, ag, ab := channels(a)
+	br, bg, bb := channels(b)
+	cr, cg, cb := channels(c)
+	total := wa + wb + wc
+	r := (ar*wa + br*wb + cr*wc) / total
+	g := (ag*wa + bg*wb + cg*wc) / total
+	bl := (ab*wa + bb*wb + cb*wc) / total
+	return r<<16 | g<<8 | bl
+}
+
+func toYUV(c uint32) (int, int, int) {
+	r, g, b := int(c>>16&0xff), int(c>>8&0xff), int(c&0xff)
+	y := (299*r + 587*g + 114*b) / 1000
+	u := (-169*r - 331*g + 500*b) / 1000
+	v := (500*r - 419*g - 81*b) / 1000
+	return y, u, v
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
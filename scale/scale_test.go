@@ -0,0 +1,168 @@
+package scale
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+var testColors = map[byte][4]byte{
+	'X': {0x10, 0x20, 0x30, 0xff},
+	'O': {0xe0, 0xd0, 0xc0, 0xff},
+}
+
+// makes an image from rows of color letters
+func testImage(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			c := testColors[row[x]]
+			copy(img.Pix[img.PixOffset(x, y):], c[:])
+		}
+	}
+	return img
+}
+
+func imageRows(img *image.RGBA) string {
+	rows := []string{}
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		row := ""
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			px := img.Pix[img.PixOffset(x, y):]
+			letter := "?"
+			for l, c := range testColors {
+				if bytes.Equal(px[:4], c[:]) {
+					letter = string(l)
+				}
+			}
+			row += letter
+		}
+		rows = append(rows, row)
+	}
+	return strings.Join(rows, "\n")
+}
+
+func TestKnownOutput(t *testing.T) {
+	checker := testImage(
+		"XO",
+		"OX",
+	)
+	for _, tc := range []struct {
+		scaler string
+		want   []string
+	}{
+		{"nearest2x", []string{
+			"XXOO",
+			"XXOO",
+			"OOXX",
+			"OOXX",
+		}},
+		{"scale2x", []string{
+			"XXOO",
+			"XOXO",
+			"OXOX",
+			"OOXX",
+		}},
+		{"scale3x", []string{
+			"XXXOOO",
+			"XXOXOO",
+			"XOOXXO",
+			"OXXOOX",
+			"OOXOXX",
+			"OOOXXX",
+		}},
+	} {
+		s, err := Get(tc.scaler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := imageRows(s.ScaleImage(checker))
+		if want := strings.Join(tc.want, "\n"); got != want {
+			t.Errorf("%s output wrong, got\n%s\nwant\n%s", tc.scaler, got, want)
+		}
+	}
+}
+
+func TestScale4xIsScale2xTwice(t *testing.T) {
+	s2x, _ := Get("scale2x")
+	s4x, _ := Get("scale4x")
+	// different sizes, so the reused buffer has to grow and shrink
+	for _, img := range []*image.RGBA{
+		testImage("XOX", "OXX", "XXO"),
+		testImage("XOOXOXXO", "OXXOOXOX", "XXOXOOXO", "OOXXOXOO", "XOXOXXOX"),
+		testImage("OX", "XX"),
+	} {
+		got := s4x.ScaleImage(img)
+		want := s2x.ScaleImage(s2x.ScaleImage(img))
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("scale4x differs from scale2x twice, got\n%s\nwant\n%s", imageRows(got), imageRows(want))
+		}
+	}
+}
+
+func TestOutputSizes(t *testing.T) {
+	src := make([]byte, 160*144*4)
+	for i := range src {
+		src[i] = byte(i * 31 / 7)
+	}
+	for _, name := range Names() {
+		s, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Factor < 1 {
+			t.Errorf("%s: bad factor %d", name, s.Factor)
+			continue
+		}
+		// extra room at the end should be left alone
+		dst := make([]byte, 160*144*s.Factor*s.Factor*4+4)
+		s.Scale(dst, src, 160, 144)
+		if !bytes.Equal(dst[len(dst)-4:], []byte{0, 0, 0, 0}) {
+			t.Errorf("%s wrote past its output", name)
+		}
+		for i := 3; i < len(dst)-4; i += 4 {
+			if dst[i] != 0xff {
+				t.Errorf("%s left pixel %d unwritten", name, i/4)
+				break
+			}
+		}
+
+		img := s.ScaleImage(testImage("XOX", "OXO"))
+		if b := img.Bounds(); b.Dx() != 3*s.Factor || b.Dy() != 2*s.Factor {
+			t.Errorf("%s: ScaleImage gave %dx%d, want %dx%d", name, b.Dx(), b.Dy(), 3*s.Factor, 2*s.Factor)
+		}
+	}
+}
+
+func TestScaleChecksSizes(t *testing.T) {
+	s, _ := Get("scale3x")
+	for _, tc := range []struct {
+		name     string
+		dst, src []byte
+	}{
+		{"small src", make([]byte, 9*4*4), make([]byte, 3*4)},
+		{"small dst", make([]byte, 9*4*4-1), make([]byte, 4*4)},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Scale didn't panic", tc.name)
+				}
+			}()
+			s.Scale(tc.dst, tc.src, 2, 2)
+		}()
+	}
+}
+
+func TestScale4xReusesBuffer(t *testing.T) {
+	s2x, _ := Get("scale2x")
+	s4x, _ := Get("scale4x")
+	src := make([]byte, 160*144*4)
+	dst := make([]byte, len(src)*16)
+	allocs2x := testing.AllocsPerRun(10, func() { s2x.Scale(dst, src, 160, 144) })
+	allocs4x := testing.AllocsPerRun(10, func() { s4x.Scale(dst, src, 160, 144) })
+	if allocs4x > allocs2x {
+		t.Errorf("scale4x made %v allocations per frame, scale2x only %v", allocs4x, allocs2x)
+	}
+}
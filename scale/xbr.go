@@ -0,0 +1,58 @@
+package scale
+
+// A simplified xBR (Hyllian's "scale by rules"): level 1 only, at 2x
+// only, without the full filter's edge-angle levels or its smoothed
+// blending. For each corner of a pixel, weigh the color differences
+// along both diagonals in a 5x5 neighborhood, and if the edge clearly
+// runs across the corner, blend the corner halfway to whichever edge
+// neighbor is closer in color.
+
+func xbrDist(a, b uint32) int {
+	ay, au, av := toYUV(a)
+	by, bu, bv := toYUV(b)
+	return 48*abs(ay-by) + 7*abs(au-bu) + 6*abs(av-bv)
+}
+
+// (sx, sy) picks the corner by mirroring the neighborhood,
+// the names are for the bottom-right corner:
+//
+//	   B
+//	D  E  F  F4
+//	G  H  I  I4
+//	   H5 I5
+//
+// with C up-right of E.
+func xbrCorner(src *frame, x, y, sx, sy int) uint32 {
+	at := func(dx, dy int) uint32 { return src.at(x+dx*sx, y+dy*sy) }
+	e := at(0, 0)
+	b, c := at(0, -1), at(1, -1)
+	d, f, f4 := at(-1, 0), at(1, 0), at(2, 0)
+	g, h, i, i4 := at(-1, 1), at(0, 1), at(1, 1), at(2, 1)
+	h5, i5 := at(0, 2), at(1, 2)
+
+	if e == f || e == h {
+		return e
+	}
+	acrossCorner := xbrDist(e, c) + xbrDist(e, g) + xbrDist(i, f4) + xbrDist(i, h5) + 4*xbrDist(h, f)
+	alongCorner := xbrDist(h, d) + xbrDist(h, i5) + xbrDist(f, i4) + xbrDist(f, b) + 4*xbrDist(e, i)
+	if acrossCorner >= alongCorner {
+		return e
+	}
+	px := h
+	if xbrDist(e, f) <= xbrDist(e, h) {
+		px = f
+	}
+	return mix2(e, 1, px, 1)
+}
+
+func xbr2x(dst []byte, src *frame) {
+	dstW := src.w * 2
+	for y := 0; y < src.h; y++ {
+		for x := 0; x < src.w; x++ {
+			put(dst, dstW, x*2, y*2, xbrCorner(src, x, y, -1, -1))
+			put(dst, dstW, x*2+1, y*2, xbrCorner(src, x, y, 1, -1))
+			put(dst, dstW, x*2, y*2+1, xbrCorner(src, x, y, -1, 1))
+			put(dst, dstW, x*2+1, y*2+1, xbrCorner(src, x, y, 1, 1))
+		}
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"io/ioutil"
 )
 
-const currentSnapshotVersion = 3
+const currentSnapshotVersion = 4
 
 const infoString = "dmgo snapshot"
 
@@ -54,6 +54,18 @@ func (cs *cpuState) convertLatestSnapshot(snap *snapshot) (*cpuState, error) {
 	newState.Mem.cart = cs.Mem.cart
 
 	newState.devMode = cs.devMode
+	newState.LCD.dmgPalette = cs.LCD.dmgPalette
+	newState.LCD.colorCorrection = cs.LCD.colorCorrection
+	newState.LCD.ghosting = cs.LCD.ghosting
+	newState.LCD.layerToggles = cs.LCD.layerToggles
+	newState.LCD.noSpriteLimit = cs.LCD.noSpriteLimit
+	newState.APU.wavOut = cs.APU.wavOut
+	newState.APU.wavErr = cs.APU.wavErr
+	newState.APU.recorder = cs.APU.recorder
+	newState.APU.recorderErr = cs.APU.recorderErr
+	newState.hooks = cs.hooks
+	newState.nextHookID = cs.nextHookID
+	newState.lockupOnIllegalOpcode = cs.lockupOnIllegalOpcode
 
 	return &newState, nil
 }
@@ -132,6 +144,39 @@ var snapshotConverters = map[int]func(map[string]interface{}) error{
 		}
 		return nil
 	},
+
+	// added 2026-10-19
+	3: func(state map[string]interface{}) error {
+		lcd, _, err := followJSON(state, "LCD")
+		if err != nil {
+			return fmt.Errorf("could not convert old v3 snapshot: %v", err)
+		}
+		lcdMap, ok := lcd.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("could not convert old v3 snapshot: lcd var is of unknown type")
+		}
+		ly, ok := lcdMap["LYReg"].(float64)
+		if !ok {
+			return fmt.Errorf("could not convert old v3 snapshot: LYReg var is of unknown type")
+		}
+		inVBlank, _ := lcdMap["InVBlank"].(bool)
+
+		// the old renderer drew whole lines at once, so there's no fifo
+		// state to carry over. Restart the current line from dot 0 instead.
+		lcdMap["CyclesSinceLYInc"] = 0
+		lcdMap["AccessingOAM"] = false
+		lcdMap["ReadingData"] = false
+		lcdMap["InHBlank"] = !inVBlank && ly != 0
+		lcdMap["ComparedLY"] = ly
+		lcdMap["ComparedLYValid"] = true
+		lcdMap["FirstLineAfterEnable"] = false
+
+		delete(lcdMap, "BGMask")
+		delete(lcdMap, "BGPriorityMask")
+		delete(lcdMap, "SpriteMask")
+		delete(lcdMap, "CyclesSinceVBlankStart")
+		return nil
+	},
 }
 
 func (cs *cpuState) convertOldSnapshot(snap *snapshot) (*cpuState, error) {
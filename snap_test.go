@@ -0,0 +1,137 @@
+package dmgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+)
+
+// repacks a snapshot after letting edit change its state json
+func editSnapshot(t *testing.T, snapBytes []byte, edit func(snap *snapshot, state map[string]interface{})) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(snapBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal(snap.State, &state); err != nil {
+		t.Fatal(err)
+	}
+	edit(&snap, state)
+	if snap.State, err = json.Marshal(state); err != nil {
+		t.Fatal(err)
+	}
+	snapJSON, err := json.Marshal(&snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	w.Write(snapJSON)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 2)
+	loaded, err := emu.LoadSnapshot(emu.MakeSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 2)
+	runFrames(loaded, 2)
+	if !bytes.Equal(emu.Framebuffer(), loaded.Framebuffer()) {
+		t.Errorf("loaded snapshot drew a different frame")
+	}
+}
+
+func TestConvertV3Snapshot(t *testing.T) {
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 1)
+	cs := emu.(*cpuState)
+	for cs.LCD.LYReg != 10 || !cs.LCD.ReadingData {
+		emu.Step()
+	}
+
+	// a v3 snapshot taken mid line, with the old scanline renderer's fields
+	v3 := editSnapshot(t, emu.MakeSnapshot(), func(snap *snapshot, state map[string]interface{}) {
+		snap.Version = 3
+		lcd := state["LCD"].(map[string]interface{})
+		for _, field := range []string{"Fetcher", "ComparedLY", "ComparedLYValid", "FirstLineAfterEnable"} {
+			delete(lcd, field)
+		}
+		lcd["BGMask"] = make([]bool, 160)
+		lcd["CyclesSinceVBlankStart"] = 0
+		lcd["CyclesSinceLYInc"] = 200
+	})
+
+	loaded, err := emu.LoadSnapshot(v3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lcd := &loaded.(*cpuState).LCD
+	if lcd.LYReg != 10 || lcd.CyclesSinceLYInc != 0 || lcd.ReadingData || lcd.AccessingOAM || !lcd.InHBlank {
+		t.Errorf("v3 snapshot didn't restart the line: LY %d, dot %d, mode 3 %v, mode 2 %v, mode 0 %v",
+			lcd.LYReg, lcd.CyclesSinceLYInc, lcd.ReadingData, lcd.AccessingOAM, lcd.InHBlank)
+	}
+	if !lcd.ComparedLYValid || lcd.ComparedLY != 10 {
+		t.Errorf("v3 snapshot comparator not set: ly %d, valid %v", lcd.ComparedLY, lcd.ComparedLYValid)
+	}
+	runFrames(loaded, 2)
+}
+
+func TestSnapshotMidLine(t *testing.T) {
+	emu, err := NewEmulator(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 1)
+	cs := emu.(*cpuState)
+	// a solid tile, and sprites of it across line 10
+	for i := 0; i < 16; i++ {
+		cs.LCD.VideoRAM[0x7f0+i] = 0xff
+	}
+	for i, x := range []byte{20, 60, 100, 140} {
+		copy(cs.LCD.OAM[i*4:], []byte{10 + 16 - 3, x + 8, 0x7f, 0})
+	}
+	cs.write(0xff40, 0x93) // sprites on
+
+	for cs.LCD.LYReg != 10 || !cs.LCD.ReadingData || cs.LCD.Fetcher.PixelX < 40 {
+		emu.Step()
+	}
+	if len(cs.LCD.OAMForScanline) != 4 {
+		t.Fatalf("line has %d sprites, want 4", len(cs.LCD.OAMForScanline))
+	}
+	loaded, err := emu.LoadSnapshot(emu.MakeSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	startX := int(cs.LCD.Fetcher.PixelX)
+	for _, e := range []Emulator{emu, loaded} {
+		for e.(*cpuState).LCD.LYReg == 10 {
+			e.Step()
+		}
+	}
+
+	line := 10 * 160 * 4
+	got := loaded.(*cpuState).LCD.framebuffer[line+startX*4 : line+160*4]
+	want := cs.LCD.framebuffer[line+startX*4 : line+160*4]
+	if !bytes.Equal(got, want) {
+		t.Errorf("rest of line 10 after x %d drew differently after loading a snapshot", startX)
+	}
+	// and the sprites really were there to lose
+	if want[(100-startX)*4] == want[(90-startX)*4] {
+		t.Errorf("sprite at x 100 wasn't drawn")
+	}
+}
@@ -0,0 +1,43 @@
+package dmgo
+
+// testROM makes a 32KB rom with a valid header that runs program
+// from 0x150 (after the usual nop; jp 0x150 at the entry point)
+func testROM(program ...byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{0x00, 0xc3, 0x50, 0x01})
+	copy(rom[0x104:], nintendoLogo[:])
+	copy(rom[0x134:], "TEST")
+	fixHeaderChecksum(rom)
+	copy(rom[0x150:], program)
+	return rom
+}
+
+// cgbTestROM is testROM, but run in CGB mode
+func cgbTestROM(program ...byte) []byte {
+	rom := testROM(program...)
+	rom[0x143] = 0x80
+	fixHeaderChecksum(rom)
+	return rom
+}
+
+func fixHeaderChecksum(rom []byte) {
+	sum := byte(0)
+	for _, b := range rom[0x134:0x14d] {
+		sum -= b + 1
+	}
+	rom[0x14d] = sum
+}
+
+// loopROM is a rom that spins forever with the LCD on
+func loopROM() []byte {
+	return testROM(0x18, 0xfe) // jr -2
+}
+
+func runFrames(emu Emulator, frames int) {
+	for n := 0; n < frames; {
+		emu.Step()
+		if emu.FlipRequested() {
+			n++
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dmgo
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Debug views of VRAM and friends, as images. They read the emulator's
+// current state without touching it, so they're safe to call between
+// Steps.
+
+// ViewerPalette picks the colors the VRAM viewers draw tiles with
+type ViewerPalette struct {
+	// Sprite picks the OBJ palettes instead of BG
+	Sprite bool
+	// Index is the CGB palette number (0-7). On DMG, it picks
+	// OBP0 or OBP1 when Sprite is set, and is ignored otherwise.
+	Index int
+}
+
+func (vp ViewerPalette) String() string {
+	if vp.Sprite {
+		return fmt.Sprintf("obj%d", vp.Index)
+	}
+	return fmt.Sprintf("bg%d", vp.Index)
+}
+
+// ParseViewerPalette parses the names ViewerPalette.String
+// gives, e.g. "bg0" or "obj1". The number can be left off.
+func ParseViewerPalette(s string) (ViewerPalette, error) {
+	vp := ViewerPalette{}
+	numStr := ""
+	switch lower := strings.ToLower(s); {
+	case strings.HasPrefix(lower, "bg"):
+		numStr = lower[2:]
+	case strings.HasPrefix(lower, "obj"):
+		vp.Sprite = true
+		numStr = lower[3:]
+	default:
+		return vp, fmt.Errorf("bad palette %q, want bg0-bg7 or obj0-obj7", s)
+	}
+	if numStr != "" {
+		n, err := strconv.Atoi(numStr)
+		if err != nil || n < 0 || n > 7 {
+			return vp, fmt.Errorf("bad palette %q, want bg0-bg7 or obj0-obj7", s)
+		}
+		vp.Index = n
+	}
+	return vp, nil
+}
+
+func (lcd *lcd) viewerColor(vp ViewerPalette, rawPixel byte) (byte, byte, byte) {
+	if lcd.CGBMode {
+		return cgbToRGB(lcd.rawPaletteValue(vp, rawPixel), lcd.colorCorrection)
+	}
+	if !vp.Sprite {
+		return applyDMGPalette(&lcd.dmgPalette.BG, (lcd.BackgroundPaletteReg>>(rawPixel*2))&0x03)
+	}
+	palReg, colors := lcd.ObjectPalette0Reg, &lcd.dmgPalette.OBJ0
+	if vp.Index&0x01 != 0 {
+		palReg, colors = lcd.ObjectPalette1Reg, &lcd.dmgPalette.OBJ1
+	}
+	return applyDMGPalette(colors, (palReg>>(rawPixel*2))&0x03)
+}
+
+func setImagePixel(img *image.RGBA, x, y int, r, g, b byte) {
+	i := img.PixOffset(x, y)
+	img.Pix[i+0] = r
+	img.Pix[i+1] = g
+	img.Pix[i+2] = b
+	img.Pix[i+3] = 0xff
+}
+
+// draws the tile at 0x8000-relative addr, unflipped
+func (lcd *lcd) drawViewerTile(img *image.RGBA, x, y int, addr uint16, vp ViewerPalette) {
+	for row := 0; row < 8; row++ {
+		lo, hi := lcd.VideoRAM[addr+uint16(row*2)], lcd.VideoRAM[addr+uint16(row*2)+1]
+		for col := 0; col < 8; col++ {
+			r, g, b := lcd.viewerColor(vp, tileRowPixel(lo, hi, byte(col), false))
+			setImagePixel(img, x+col, y+row, r, g, b)
+		}
+	}
+}
+
+// TilesImage draws all 384 tiles in VRAM in a 16x24 grid of tiles, in
+// address order (0x8000 top left). On CGB, bank 1's tiles are drawn in
+// a second grid to the right of bank 0's.
+func (cs *cpuState) TilesImage(vp ViewerPalette) *image.RGBA {
+	return cs.LCD.tilesImage(vp)
+}
+
+func (lcd *lcd) tilesImage(vp ViewerPalette) *image.RGBA {
+	banks := 1
+	if lcd.CGBMode {
+		banks = 2
+	}
+	img := image.NewRGBA(image.Rect(0, 0, banks*16*8, 24*8))
+	for bank := 0; bank < banks; bank++ {
+		for i := 0; i < 384; i++ {
+			x, y := bank*16*8+(i%16)*8, (i/16)*8
+			lcd.drawViewerTile(img, x, y, uint16(bank*0x2000+i*16), vp)
+		}
+	}
+	return img
+}
+
+// TileMap picks a tile map for TileMapImage
+type TileMap int
+
+const (
+	// TileMapBG is whichever map LCDC has the background using
+	TileMapBG TileMap = iota
+	// TileMapWindow is whichever map LCDC has the window using
+	TileMapWindow
+	// TileMap9800 is the map at 0x9800
+	TileMap9800
+	// TileMap9C00 is the map at 0x9c00
+	TileMap9C00
+)
+
+var tileMapNames = []string{"bg", "window", "9800", "9c00"}
+
+func (tm TileMap) String() string {
+	if tm >= 0 && int(tm) < len(tileMapNames) {
+		return tileMapNames[tm]
+	}
+	return fmt.Sprintf("TileMap(%d)", int(tm))
+}
+
+// ParseTileMap parses the names TileMap.String gives
+func ParseTileMap(s string) (TileMap, error) {
+	for i, name := range tileMapNames {
+		if strings.EqualFold(s, name) {
+			return TileMap(i), nil
+		}
+	}
+	return 0, fmt.Errorf("bad tile map %q, want one of: %s", s, strings.Join(tileMapNames, ", "))
+}
+
+// overlay colors for TileMapImage
+var (
+	viewportOverlayColor = RGB{0xff, 0x00, 0x00}
+	windowOverlayColor   = RGB{0x00, 0x60, 0xff}
+)
+
+// TileMapImage draws a whole 32x32 tile map as a 256x256 image, with
+// tile data addressing and palettes as they are right now (and CGB tile
+// attributes from VRAM bank 1). With overlay set, the screen's
+// SCX/SCY viewport is outlined in red if this is the BG's map (wrapping
+// around the edges like the BG does), and the part the window shows is
+// outlined in blue if this is the window's map and the window is on.
+func (cs *cpuState) TileMapImage(tm TileMap, overlay bool) *image.RGBA {
+	return cs.LCD.tileMapImage(tm, overlay)
+}
+
+func (lcd *lcd) tileMapAddr(tm TileMap) uint16 {
+	switch tm {
+	case TileMapWindow:
+		return lcd.getWindowTileMapAddr()
+	case TileMap9800:
+		return 0x1800
+	case TileMap9C00:
+		return 0x1c00
+	}
+	return lcd.getBGTileMapAddr()
+}
+
+func (lcd *lcd) tileMapImage(tm TileMap, overlay bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	mapAddr := lcd.tileMapAddr(tm)
+	dataAddr := lcd.getBGAndWindowTileDataAddr()
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			tileNum := lcd.getTileNum(mapAddr, byte(x), byte(y))
+			attrs := tileAttrsFromByte(lcd.getTileAttrByte(mapAddr, byte(x), byte(y)))
+			pix := lcd.getTilePixel(dataAddr, attrs, tileNum, byte(x), byte(y))
+			r, g, b := lcd.applyBGPalettes(attrs, pix)
+			setImagePixel(img, x, y, r, g, b)
+		}
+	}
+	if overlay {
+		if mapAddr == lcd.getBGTileMapAddr() {
+			drawOverlayRect(img, int(lcd.ScrollX), int(lcd.ScrollY), 160, 144, viewportOverlayColor)
+		}
+		if mapAddr == lcd.getWindowTileMapAddr() && lcd.DisplayWindow && lcd.WindowX < 167 && lcd.WindowY < 144 {
+			// the window's top left is always the map's top left
+			w := 160 - (int(lcd.WindowX) - 7)
+			if w > 160 {
+				w = 160
+			}
+			h := 144 - int(lcd.WindowY)
+			drawOverlayRect(img, 0, 0, w, h, windowOverlayColor)
+		}
+	}
+	return img
+}
+
+// outline that wraps around the edges of a 256x256 map
+func drawOverlayRect(img *image.RGBA, x, y, w, h int, c RGB) {
+	for i := 0; i < w; i++ {
+		setImagePixel(img, (x+i)&0xff, y&0xff, c.R, c.G, c.B)
+		setImagePixel(img, (x+i)&0xff, (y+h-1)&0xff, c.R, c.G, c.B)
+	}
+	for j := 0; j < h; j++ {
+		setImagePixel(img, x&0xff, (y+j)&0xff, c.R, c.G, c.B)
+		setImagePixel(img, (x+w-1)&0xff, (y+j)&0xff, c.R, c.G, c.B)
+	}
+}
+
+// DumpTiles writes the tile viewer's output (BG palette) to tiledata.tga
+func (lcd *lcd) DumpTiles() {
+	img := lcd.tilesImage(ViewerPalette{})
+	writeTgaRGBA("tiledata.tga", img.Rect.Dx(), img.Rect.Dy(), img.Pix)
+}
@@ -0,0 +1,174 @@
+package dmgo
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// the color numbers of each row of the test tile (tile 5)
+var viewerTestTileRow = [8]byte{3, 3, 1, 1, 2, 2, 0, 0}
+
+// newViewerTestState has empty VRAM and OAM except for tile 5,
+// each row of which is viewerTestTileRow, and identity palettes
+func newViewerTestState(t *testing.T) *cpuState {
+	t.Helper()
+	cs, err := newState(loopROM(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cs.LCD.VideoRAM {
+		cs.LCD.VideoRAM[i] = 0
+	}
+	for i := range cs.LCD.OAM {
+		cs.LCD.OAM[i] = 0
+	}
+	for row := 0; row < 8; row++ {
+		cs.LCD.VideoRAM[5*16+row*2], cs.LCD.VideoRAM[5*16+row*2+1] = 0xf0, 0xcc
+	}
+	cs.LCD.BackgroundPaletteReg = 0xe4
+	cs.LCD.ObjectPalette0Reg = 0xe4
+	cs.LCD.ObjectPalette1Reg = 0xe4
+	return cs
+}
+
+var greyShades = [4]color.RGBA{{0xff, 0xff, 0xff, 0xff}, {0xaa, 0xaa, 0xaa, 0xff}, {0x55, 0x55, 0x55, 0xff}, {0x00, 0x00, 0x00, 0xff}}
+
+// checkImage compares every pixel of img with want(x, y)
+func checkImage(t *testing.T, name string, img *image.RGBA, w, h int, want func(x, y int) color.RGBA) {
+	t.Helper()
+	if img.Rect.Dx() != w || img.Rect.Dy() != h {
+		t.Fatalf("%s: image is %dx%d, want %dx%d", name, img.Rect.Dx(), img.Rect.Dy(), w, h)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if got, want := img.RGBAAt(x, y), want(x, y); got != want {
+				t.Fatalf("%s: pixel (%d, %d) is %v, want %v", name, x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestTilesImage(t *testing.T) {
+	cs := newViewerTestState(t)
+	cs.LCD.ObjectPalette1Reg = 0x1b // reversed
+	for _, tc := range []struct {
+		vp     ViewerPalette
+		shades [4]byte
+	}{
+		{ViewerPalette{}, [4]byte{0, 1, 2, 3}},
+		{ViewerPalette{Sprite: true, Index: 1}, [4]byte{3, 2, 1, 0}},
+	} {
+		// tile 5 is the 6th in the top row of the 16 wide grid
+		checkImage(t, "tiles "+tc.vp.String(), cs.TilesImage(tc.vp), 128, 192, func(x, y int) color.RGBA {
+			pix := byte(0)
+			if x >= 5*8 && x < 6*8 && y < 8 {
+				pix = viewerTestTileRow[x-5*8]
+			}
+			return greyShades[tc.shades[pix]]
+		})
+	}
+}
+
+func TestTileMapImage(t *testing.T) {
+	cs := newViewerTestState(t)
+	cs.LCD.VideoRAM[0x1800+1*32+2] = 5 // tile 5 at map x 2, y 1
+	cs.LCD.ScrollX, cs.LCD.ScrollY = 100, 200
+	mapPixel := func(x, y int) color.RGBA {
+		if x >= 2*8 && x < 3*8 && y >= 8 && y < 2*8 {
+			return greyShades[viewerTestTileRow[x-2*8]]
+		}
+		return greyShades[0]
+	}
+	checkImage(t, "bg map", cs.TileMapImage(TileMapBG, false), 256, 256, mapPixel)
+
+	// the viewport outline wraps around to the top left
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	checkImage(t, "bg map with overlay", cs.TileMapImage(TileMapBG, true), 256, 256, func(x, y int) color.RGBA {
+		left, right := x == 100, x == (100+159)&0xff
+		top, bottom := y == 200, y == (200+143)&0xff
+		inX := x >= 100 || x <= (100+159)&0xff
+		inY := y >= 200 || y <= (200+143)&0xff
+		if ((left || right) && inY) || ((top || bottom) && inX) {
+			return red
+		}
+		return mapPixel(x, y)
+	})
+
+	// the other map is empty
+	checkImage(t, "9c00 map", cs.TileMapImage(TileMap9C00, false), 256, 256, func(x, y int) color.RGBA {
+		return greyShades[0]
+	})
+}
+
+func TestSpriteSheetImage(t *testing.T) {
+	cs := newViewerTestState(t)
+	cs.LCD.ObjectPalette1Reg = 0x1b // reversed
+	// sprite 9 at 30, 20: tile 5, x flipped, OBP1
+	copy(cs.LCD.OAM[9*4:], []byte{20 + 16, 30 + 8, 5, 0x30})
+
+	// sprite 9 is second in the second row, the rest are all color 0
+	checkImage(t, "sprite sheet", cs.SpriteSheetImage(), 64, 40, func(x, y int) color.RGBA {
+		if x >= 8 && x < 16 && y >= 8 && y < 16 {
+			if pix := viewerTestTileRow[7-(x-8)]; pix != 0 {
+				return greyShades[3-pix]
+			}
+		}
+		return color.RGBA{}
+	})
+
+	info := cs.InspectOAM()[9]
+	if info.X != 30 || info.Y != 20 || info.Tile != 5 || !info.XFlip || info.YFlip || info.DMGPalette != 1 || !info.Visible {
+		t.Errorf("sprite 9 decoded as %+v", info)
+	}
+	if len(info.Lines) != 8 || info.Lines[0] != 20 || len(info.DroppedLines) != 0 {
+		t.Errorf("sprite 9 is on lines %v, dropped from %v, want 20-27 and none", info.Lines, info.DroppedLines)
+	}
+}
+
+func TestPalettesImage(t *testing.T) {
+	cs := newViewerTestState(t)
+	cs.LCD.ObjectPalette0Reg = 0x1b // reversed
+	cs.LCD.ObjectPalette1Reg = 0x00 // all lightest
+	white := greyShades[0]
+	// bg0 top left, obj0 and obj1 down the right, nothing under bg0
+	checkImage(t, "dmg palettes", cs.PalettesImage(), 128, 32, func(x, y int) color.RGBA {
+		i := (x % 64) / paletteSwatchSize
+		switch {
+		case x < 64 && y < 16:
+			return greyShades[i]
+		case x >= 64 && y < 16:
+			return greyShades[3-i]
+		}
+		return white
+	})
+
+	cgb, err := newState(cgbTestROM(0x18, 0xfe), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cgb.LCD.BGPaletteRAM {
+		cgb.LCD.BGPaletteRAM[i] = 0
+		cgb.LCD.SpritePaletteRAM[i] = 0
+	}
+	if err := cgb.SetPaletteColor(ViewerPalette{Index: 3}, 2, 0x001f); err != nil {
+		t.Fatal(err)
+	}
+	if err := cgb.SetPaletteColor(ViewerPalette{Sprite: true, Index: 7}, 1, 0x7c00); err != nil {
+		t.Fatal(err)
+	}
+	toRGBA := func(c uint16) color.RGBA {
+		r, g, b := cgbToRGB(c, cgb.LCD.colorCorrection)
+		return color.RGBA{r, g, b, 0xff}
+	}
+	checkImage(t, "cgb palettes", cgb.PalettesImage(), 128, 128, func(x, y int) color.RGBA {
+		i, row := (x%64)/paletteSwatchSize, y/paletteSwatchSize
+		switch {
+		case x < 64 && row == 3 && i == 2:
+			return toRGBA(0x001f)
+		case x >= 64 && row == 7 && i == 1:
+			return toRGBA(0x7c00)
+		}
+		return toRGBA(0)
+	})
+}
@@ -0,0 +1,82 @@
+package dmgo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// format of the sound from ReadSoundBuffer
+const (
+	soundChannels       = 2
+	soundBytesPerSample = 2 * soundChannels // 16-bit little endian, left then right
+)
+
+func putWaveFormat(b []byte) {
+	binary.LittleEndian.PutUint16(b[0:], 1) // PCM
+	binary.LittleEndian.PutUint16(b[2:], soundChannels)
+	binary.LittleEndian.PutUint32(b[4:], samplesPerSecond)
+	binary.LittleEndian.PutUint32(b[8:], samplesPerSecond*soundBytesPerSample)
+	binary.LittleEndian.PutUint16(b[12:], soundBytesPerSample)
+	binary.LittleEndian.PutUint16(b[14:], 16)
+}
+
+// wavWriter streams sound to a .wav, filling in the sizes on close
+type wavWriter struct {
+	f       *os.File
+	w       *bufio.Writer
+	dataLen uint32
+}
+
+const wavHeaderSize = 44
+
+func createWAV(filename string) (*wavWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, wavHeaderSize)
+	copy(hdr[0:], "RIFF")
+	copy(hdr[8:], "WAVE")
+	copy(hdr[12:], "fmt ")
+	binary.LittleEndian.PutUint32(hdr[16:], 16)
+	putWaveFormat(hdr[20:])
+	copy(hdr[36:], "data")
+	ww := &wavWriter{f: f, w: bufio.NewWriter(f)}
+	if _, err := ww.w.Write(hdr); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ww, nil
+}
+
+func (ww *wavWriter) write(samples []byte) error {
+	if uint64(ww.dataLen)+uint64(len(samples)) > 0xffffffff-wavHeaderSize {
+		return fmt.Errorf("wav file full (4GB)")
+	}
+	n, err := ww.w.Write(samples)
+	ww.dataLen += uint32(n)
+	return err
+}
+
+func (ww *wavWriter) close() error {
+	err := ww.w.Flush()
+	if err == nil {
+		err = patchUint32(ww.f, 4, wavHeaderSize-8+ww.dataLen)
+	}
+	if err == nil {
+		err = patchUint32(ww.f, 40, ww.dataLen)
+	}
+	if closeErr := ww.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func patchUint32(f *os.File, offset int64, val uint32) error {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, val)
+	_, err := f.WriteAt(b, offset)
+	return err
+}
@@ -0,0 +1,93 @@
+package dmgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// records 30 frames of sound straight from the apu, reading it out the
+// way playback would, or reading more than there is every 10 frames.
+// Returns the wav and how many samples the apu's clock should have made.
+func recordTestWAV(t *testing.T, overRead bool) ([]byte, int) {
+	emu, err := NewEmulator(testROM(soundTestProgram...), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(emu, 2)
+	filename := filepath.Join(t.TempDir(), "sound.wav")
+	if err := emu.StartSoundRecording(filename); err != nil {
+		t.Fatal(err)
+	}
+	startCycles := emu.(*cpuState).Cycles
+	playback := make([]byte, 8192)
+	for frame := 0; frame < 30; frame++ {
+		runFrames(emu, 1)
+		if overRead && frame%10 == 9 {
+			// more than there is, so the buffer has to be stretched
+			want := emu.GetSoundBufferInfo().UsedSize + 1000*soundBytesPerSample
+			if got := len(emu.ReadSoundBuffer(make([]byte, want))); got != want {
+				t.Fatalf("underflow read gave %d bytes, want %d", got, want)
+			}
+		} else if emu.GetSoundBufferInfo().UsedSize >= len(playback) {
+			emu.ReadSoundBuffer(playback)
+		}
+	}
+	// the apu runs at half the cpu clock, and makes a sample every clocksPerSample
+	emulated := int(emu.(*cpuState).Cycles-startCycles) / 2 / clocksPerSample
+	if err := emu.StopSoundRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if emu.IsRecordingSound() {
+		t.Errorf("still recording after stopping")
+	}
+	if err := emu.StopSoundRecording(); err == nil {
+		t.Errorf("stopping twice didn't error")
+	}
+	wav, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wav, emulated
+}
+
+// plays a steady square wave on channel 2
+var soundTestProgram = []byte{
+	0x3e, 0x80, 0xe0, 0x26, // ld a,0x80; ldh (NR52),a
+	0x3e, 0x77, 0xe0, 0x24, // ld a,0x77; ldh (NR50),a
+	0x3e, 0xff, 0xe0, 0x25, // ld a,0xff; ldh (NR51),a
+	0x3e, 0x80, 0xe0, 0x16, // ld a,0x80; ldh (NR21),a
+	0x3e, 0xf0, 0xe0, 0x17, // ld a,0xf0; ldh (NR22),a
+	0x3e, 0x00, 0xe0, 0x18, // ld a,0x00; ldh (NR23),a
+	0x3e, 0x87, 0xe0, 0x19, // ld a,0x87; ldh (NR24),a
+	0x18, 0xfe, // jr -2
+}
+
+func TestSoundRecordingAcrossUnderflow(t *testing.T) {
+	wav, emulated := recordTestWAV(t, false)
+	stretched, _ := recordTestWAV(t, true)
+
+	if len(wav) < wavHeaderSize || string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Fatalf("bad wav header")
+	}
+	dataLen := len(wav) - wavHeaderSize
+	if samples := dataLen / soundBytesPerSample; samples < emulated-1 || samples > emulated+1 {
+		t.Errorf("wav has %d samples, the apu's clock made %d", samples, emulated)
+	}
+	if riffLen := int(binary.LittleEndian.Uint32(wav[4:])); riffLen != len(wav)-8 {
+		t.Errorf("riff size is %d, want %d", riffLen, len(wav)-8)
+	}
+	if hdrDataLen := int(binary.LittleEndian.Uint32(wav[40:])); hdrDataLen != dataLen {
+		t.Errorf("data size is %d, want %d", hdrDataLen, dataLen)
+	}
+	if rate := binary.LittleEndian.Uint32(wav[24:]); rate != samplesPerSecond {
+		t.Errorf("sample rate is %d", rate)
+	}
+
+	// underflows stretch what's played, never what's recorded
+	if !bytes.Equal(wav, stretched) {
+		t.Errorf("recording with underflows differs: %d bytes vs %d", len(stretched), len(wav))
+	}
+}